@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -14,12 +15,14 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: counttext <input-file>")
+	source := flag.String("source", "en", "翻訳元の言語（en, ja など）")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Println("Usage: counttext [-source en] <input-file>")
 		os.Exit(1)
 	}
 
-	filePath := os.Args[1]
+	filePath := flag.Arg(0)
 
 	// ファイルを読み込む
 	content, err := ioutil.ReadFile(filePath)
@@ -29,21 +32,18 @@ func main() {
 
 	markdownString := string(content)
 
-	nodes := parser.ParseMarkdown(markdownString)
+	nodes := parser.ParseMarkdownWithOptions(markdownString, parser.OptionsForPath(filePath))
 	for _, node := range nodes {
-		fmt.Println(node)
+		fmt.Printf("%s:%s\n", filePath, node)
 	}
 
 	targetNodes := []*parser.Node{}
 	for _, node := range nodes {
-		switch node.Type {
-		case parser.Heading, parser.Paragraph, parser.Item, parser.OrderedItem, parser.Table:
-			if !textprocesser.ContainsEnglishWords(node.Text) {
-				continue
-			}
-
-			targetNodes = append(targetNodes, node)
+		if !parser.IsTranslationTarget(node) || !textprocesser.ContainsLanguage(node.Text, *source) {
+			continue
 		}
+
+		targetNodes = append(targetNodes, node)
 	}
 
 	bytes, err := ioutil.ReadFile("db_modified.json")
@@ -58,8 +58,10 @@ func main() {
 		return
 	}
 
+	// キャッシュのキーは正規化したテキスト（古いDBは元のテキスト）
 	for _, node := range targetNodes {
 		items = removeItem(items, node.Text)
+		items = removeItem(items, parser.NormalizeText(node.Text))
 	}
 
 	if len(items) == 0 {
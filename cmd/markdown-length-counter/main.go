@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -15,6 +16,7 @@ import (
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/gpt35/generator"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/parser"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/textprocesser"
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/translate"
 )
 
 func main() {
@@ -23,12 +25,29 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: counttext <input-file>")
+	source := flag.String("source", translate.DefaultLanguagePair.Source, "翻訳元の言語（en, ja など）")
+	target := flag.String("target", translate.DefaultLanguagePair.Target, "翻訳先の言語（ja, ko, en など。カンマ区切りで複数指定するとすべての言語の分を数える）")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Println("Usage: counttext [-source en] [-target ja,ko,zh] <input-file>")
 		os.Exit(1)
 	}
 
-	filePath := os.Args[1]
+	targets := []string{}
+	for _, t := range strings.Split(*target, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if err := (translate.LanguagePair{Source: *source, Target: t}).Validate(); err != nil {
+			log.Fatal(err)
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		log.Fatal("no target language")
+	}
+
+	filePath := flag.Arg(0)
 
 	// ファイルを読み込む
 	content, err := ioutil.ReadFile(filePath)
@@ -38,17 +57,17 @@ func main() {
 
 	markdownString := string(content)
 
-	nodes := parser.ParseMarkdown(markdownString)
+	nodes := parser.ParseMarkdownWithOptions(markdownString, parser.OptionsForPath(filePath))
 
 	codePoints := 0
 	for _, node := range nodes {
-		switch node.Type {
-		case parser.Heading, parser.Paragraph, parser.Item, parser.OrderedItem, parser.Table:
-			if !textprocesser.ContainsEnglishWords(node.Text) {
-				continue
-			}
+		if !parser.IsTranslationTarget(node) || !textprocesser.ContainsLanguage(node.Text, *source) {
+			continue
+		}
 
-			gptInputStr, err := generator.GenerateGptInputString(node.Text)
+		// 翻訳先の言語ごとにプロンプトを送る
+		for _, t := range targets {
+			gptInputStr, err := generator.GenerateGptInputStringFor(node.Text, *source, t)
 			if err != nil {
 				log.Fatal(err)
 			}
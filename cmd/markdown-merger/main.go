@@ -35,7 +35,7 @@ func mergeMarkdownFiles(outputFile, inputDir string) error {
 			return err
 		}
 
-		if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".md") && info.Name() != "merged.md" && info.Name() != "translated.md" {
+		if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".md") && info.Name() != "merged.md" && !isTranslatedFile(info.Name()) {
 			content, err := ioutil.ReadFile(path)
 			if err != nil {
 				return err
@@ -54,3 +54,8 @@ func mergeMarkdownFiles(outputFile, inputDir string) error {
 
 	return ioutil.WriteFile(outputFile, []byte(mergedContent.String()), 0644)
 }
+
+// translaterが書き出したファイル（translated.md と translated.<lang>.md）
+func isTranslatedFile(name string) bool {
+	return strings.HasPrefix(name, "translated.") && strings.HasSuffix(name, ".md")
+}
@@ -8,8 +8,106 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/parser"
 )
 
+// md-to-pdfのスタイルの設定
+var headerLines = []string{
+	"stylesheet: https://cdnjs.cloudflare.com/ajax/libs/github-markdown-css/2.10.0/github-markdown.min.css",
+	"body_class: markdown-body",
+}
+
+// 先頭にmd-to-pdfの設定のフロントマターを追加する（既にフロントマターがあればそこに足す）
+func addHeader(markdown string) string {
+	header := "---\n" + strings.Join(headerLines, "\n") + "\n---"
+
+	nodes := parser.ParseMarkdown(markdown)
+	if len(nodes) == 0 || nodes[0].Type != parser.FrontMatter {
+		return header + "\n\n" + markdown
+	}
+
+	frontMatter := nodes[0]
+	body := markdown[frontMatter.End:]
+	lines := strings.Split(frontMatter.Raw, "\n")
+	closer := lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	if frontMatter.FrontMatterFormat != parser.YAMLFrontMatter {
+		// md-to-pdfはYAMLのフロントマターしか読めないので、TOMLのフロントマターはYAMLに書き換える
+		yamlLines, dropped := tomlToYAML(lines[1:])
+		if len(dropped) > 0 {
+			log.Printf("dropped TOML front matter lines that cannot be converted to YAML:\n%s", strings.Join(dropped, "\n"))
+		}
+		lines = append([]string{"---"}, yamlLines...)
+		closer = "---"
+	}
+
+	// 閉じる区切りの行の前に、まだ書かれていないキーだけを足す
+	for _, headerLine := range headerLines {
+		key := headerLine[:strings.Index(headerLine, ":")+1]
+		exists := false
+		for _, line := range lines {
+			if strings.HasPrefix(line, key) {
+				exists = true
+			}
+		}
+		if !exists {
+			lines = append(lines, headerLine)
+		}
+	}
+	lines = append(lines, closer)
+
+	return strings.Join(lines, "\n") + body
+}
+
+var tomlKeyValuePattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)[ \t]*=[ \t]*(.*)$`)
+
+// TOMLのトップレベルの1行で書かれたキーと値をYAMLの行にする
+// 文字列・数値・真偽値・日時・1行の配列はYAMLでもそのまま読めるので、= を : に変えるだけにする
+// 複数行の文字列・インラインテーブル・テーブルより後ろの行は移せなかった行として返す
+func tomlToYAML(lines []string) ([]string, []string) {
+	var yamlLines, dropped []string
+	multiline := "" // 閉じていない複数行の文字列の区切り
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case multiline != "":
+			if strings.Contains(line, multiline) {
+				multiline = ""
+			}
+			dropped = append(dropped, line)
+			continue
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			yamlLines = append(yamlLines, trimmed)
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			// テーブルより後ろはトップレベルのキーではない
+			return yamlLines, append(dropped, lines[i:]...)
+		}
+
+		m := tomlKeyValuePattern.FindStringSubmatch(trimmed)
+		if m == nil {
+			dropped = append(dropped, line)
+			continue
+		}
+		value := m[2]
+		for _, delimiter := range []string{`"""`, "'''"} {
+			if strings.HasPrefix(value, delimiter) && !strings.Contains(value[3:], delimiter) {
+				multiline = delimiter
+			}
+		}
+		if strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''") || strings.HasPrefix(value, "{") ||
+			(strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]")) {
+			dropped = append(dropped, line)
+			continue
+		}
+		yamlLines = append(yamlLines, m[1]+": "+value)
+	}
+	return yamlLines, dropped
+}
+
 func main() {
 	if len(os.Args) != 3 {
 		log.Fatalf("Usage: markdown-to-pdf <input-file> <output-file>")
@@ -29,14 +127,8 @@ func main() {
 
 	markdownString := string(content)
 
-	// 追加する文字列
-	header := `---
-stylesheet: https://cdnjs.cloudflare.com/ajax/libs/github-markdown-css/2.10.0/github-markdown.min.css
-body_class: markdown-body
----`
-
-	// テンプレートを作成して、先頭に追加
-	mdStrWithHeader := header + "\n\n" + markdownString
+	// md-to-pdfの設定を先頭に追加
+	mdStrWithHeader := addHeader(markdownString)
 
 	// ファイルを作成する
 	tmpFileName := "tmp.md"
@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/parser"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/translate"
 )
 
@@ -45,6 +46,20 @@ func main() {
 		return
 	}
 
+	// 元のマークダウンが指定されていれば、修正が必要な箇所のソース上の位置も表示する
+	positions := map[string][]string{}
+	if len(os.Args) > 1 {
+		content, err := ioutil.ReadFile(os.Args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, node := range parser.ParseMarkdown(string(content)) {
+			// キャッシュのsource_textは正規化したテキストなので、同じく正規化したテキストで引く
+			key := parser.NormalizeText(node.Text)
+			positions[key] = append(positions[key], os.Args[1]+":"+node.Position())
+		}
+	}
+
 	// プログラム上で可能な置換処置を行う
 	for _, item := range items {
 		if !strings.Contains(item.SourceText, "# ") {
@@ -56,6 +71,7 @@ func main() {
 			item.FormattedText = strings.ReplaceAll(item.FormattedText, "\n", "")
 		}
 
+		// プレースホルダーを使う前に翻訳されたリンクの修復
 		re := regexp.MustCompile(`\[(.*?)\]（(.*?)）`)
 		item.FormattedText = re.ReplaceAllString(item.FormattedText, "[$1]($2)")
 	}
@@ -85,11 +101,22 @@ func main() {
 		if strings.Contains(item.FormattedText, "# ") {
 			set.Add(i)
 		}
+
+		// 翻訳で失われたインラインコードやリンク先の検索
+		for _, placeholder := range parser.ProtectInline(item.SourceText).Placeholders {
+			if !strings.Contains(item.FormattedText, placeholder.Original) {
+				set.Add(i)
+				break
+			}
+		}
 	}
 
 	for k, v := range set {
 		if v {
 			item := items[k]
+			for _, position := range positions[parser.NormalizeText(item.SourceText)] {
+				fmt.Printf("position: %s\n", position)
+			}
 			fmt.Printf("sourceText: %q\n", item.SourceText)
 			fmt.Printf("formattedText: %q\n", item.FormattedText)
 			fmt.Println()
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -15,13 +18,12 @@ import (
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/gpt35"
-	"github.com/sofuetakuma112/go-markdown-translater/pkg/gpt35/generator"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/highlightCode"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/parser"
 	"github.com/sofuetakuma112/go-markdown-translater/pkg/textprocesser"
 
-	// "github.com/sofuetakuma112/go-markdown-translater/pkg/translate"
 	"github.com/joho/godotenv"
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/translate"
 )
 
 func main() {
@@ -38,15 +40,6 @@ func main() {
 	defer db.Close()
 
 	// テーブルの初期化
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS translations (
-		source_text TEXT PRIMARY KEY,
-		translated_text TEXT,
-		formatted_text TEXT
-	)`)
-	if err != nil {
-		panic(err)
-	}
-
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS codes (
 		code TEXT PRIMARY KEY,
 		lang TEXT
@@ -55,22 +48,104 @@ func main() {
 		panic(err)
 	}
 
-	// GPT3.5クライアントの初期化
-	// APIキーを環境変数から取得
-	openaiApiKey := os.Getenv("OPENAI_API_KEY")
-	if openaiApiKey == "" {
-		fmt.Println("OPENAI_API_KEY environment variable is not set")
-		return
+	// 翻訳エンジンは -provider か環境変数 TRANSLATOR_PROVIDER で選ぶ
+	defaultProvider := os.Getenv("TRANSLATOR_PROVIDER")
+	if defaultProvider == "" {
+		defaultProvider = "chat"
+	}
+	provider := flag.String("provider", defaultProvider, "翻訳エンジン（chat: Chat Completions API, apps-script: Google Apps Script）")
+	model := flag.String("model", gpt35.ModelGpt35Turbo, "-provider chat で使うモデル")
+	translateHTML := flag.Bool("translate-html", false, "HTMLブロック内のテキストも翻訳する（タグと属性はそのまま残す）")
+	frontMatterKeys := flag.String("front-matter-keys", strings.Join(parser.DefaultFrontMatterKeys, ","), "翻訳するフロントマターのキー（カンマ区切り）")
+	skipCodeColumns := flag.Bool("skip-code-columns", parser.OptionsForPath("").SkipTableCodeColumns, "コードや識別子だけのテーブルの列を翻訳しない")
+	translateMermaidLabels := flag.Bool("translate-mermaid-labels", false, "Mermaidのフローチャートとシーケンス図のラベルを翻訳する")
+	headingAnchors := flag.String("heading-anchors", "html", "翻訳した見出しに元のアンカーを残す方法（none, attribute: {#id}, html: <a id>）")
+	jsxProps := flag.String("jsx-props", strings.Join(parser.DefaultJSXProps, ","), "MDXで翻訳するJSXの文字列のprops（カンマ区切り）")
+	source := flag.String("source", translate.DefaultLanguagePair.Source, "翻訳元の言語（en, ja など）")
+	target := flag.String("target", translate.DefaultLanguagePair.Target, "翻訳先の言語（ja, ko, en など。言語ごとに translated.<lang>.md に書き出す。カンマ区切りで複数指定できる）")
+	contextSize := flag.Int("context", 0, "-provider chat でプロンプトに文脈として入れる直前の段落の数（0なら文脈を入れない。タイトルと見出しの階層も入れる。段落の訳はキャッシュにあったものだけを入れる）")
+	maxTokens := flag.Int("max-tokens", gpt35.MaxTokensGpt35Turbo, "-provider chat で使うモデルのトークン数の上限（文脈はこれに収まるように削る）")
+	batchTokens := flag.Int("batch-tokens", 0, "複数のNodeを <<<SEG index>>> の行で区切ってまとめ、1回のリクエストに詰めるトークン数の上限（0ならNodeごとに翻訳する）")
+	cacheKey := flag.String("cache-key", "text", "翻訳のキャッシュのキー（text: 正規化したテキスト, id: 見出しの階層を含むNodeのID）")
+	strict := flag.Bool("strict", false, "閉じていないコードフェンスなどの問題があれば翻訳せずに終了する")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Println("Usage: translater [-source en] [-target ja,ko,zh] [-provider chat|apps-script] [-model gpt-3.5-turbo] [-translate-html] [-front-matter-keys title,description] [-skip-code-columns=false] [-translate-mermaid-labels] [-heading-anchors none|attribute|html] [-jsx-props label,title] [-strict] [-cache-key text|id] [-batch-tokens 1000] [-context 3] [-max-tokens 4096] <input-file>")
+		os.Exit(1)
 	}
 
-	c := gpt35.NewClient(openaiApiKey)
+	if *cacheKey != "text" && *cacheKey != "id" {
+		log.Fatalf("unknown cache key: %s", *cacheKey)
+	}
 
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: counttext <input-file>")
-		os.Exit(1)
+	targets := []string{}
+	for _, t := range strings.Split(*target, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	pairs := []translate.LanguagePair{}
+	seen := map[string]bool{}
+	for _, t := range targets {
+		languages := translate.LanguagePair{Source: *source, Target: t}
+		if err := languages.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		if seen[t] {
+			log.Fatalf("duplicated target language: %s", t)
+		}
+		seen[t] = true
+		pairs = append(pairs, languages)
+	}
+	if len(pairs) == 0 {
+		log.Fatal("no target language")
 	}
 
-	filePath := os.Args[1]
+	// 翻訳エンジンは言語の組ごとに作る
+	var openaiApiKey string
+	switch *provider {
+	case "chat":
+		// APIキーを環境変数から取得
+		openaiApiKey = os.Getenv("OPENAI_API_KEY")
+		if openaiApiKey == "" {
+			fmt.Println("OPENAI_API_KEY environment variable is not set")
+			return
+		}
+	case "apps-script":
+	default:
+		log.Fatalf("unknown provider: %s", *provider)
+	}
+	newTranslator := func(languages translate.LanguagePair) translate.Translator {
+		var translator translate.Translator
+		if *provider == "apps-script" {
+			translator = translate.NewAppsScriptTranslator(languages)
+		} else {
+			chat := translate.NewChatTranslator(gpt35.NewClient(openaiApiKey), languages)
+			chat.Model = gpt35.ModelType(*model)
+			chat.MaxTokens = *maxTokens
+			if *batchTokens > 0 {
+				chat.System = translate.BatchSystemPrompt
+			}
+			translator = chat
+		}
+		if *batchTokens > 0 {
+			return translate.NewBatchTranslator(translator, *batchTokens)
+		}
+		return translator
+	}
+
+	anchors := map[string]parser.HeadingAnchor{
+		"none":      parser.AnchorNone,
+		"attribute": parser.AnchorAttribute,
+		"html":      parser.AnchorHTML,
+	}
+	anchor, ok := anchors[*headingAnchors]
+	if !ok {
+		log.Fatalf("unknown heading anchors: %s", *headingAnchors)
+	}
+
+	filePath := flag.Arg(0)
 
 	// ファイルを読み込む
 	content, err := ioutil.ReadFile(filePath)
@@ -78,15 +153,53 @@ func main() {
 		log.Fatalf("Error reading file: %v", err)
 	}
 
-	markdownString := string(content)
+	keys := []string{}
+	for _, key := range strings.Split(*frontMatterKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
 
-	nodes := parser.ParseMarkdown(markdownString)
+	props := []string{}
+	for _, prop := range strings.Split(*jsxProps, ",") {
+		if prop = strings.TrimSpace(prop); prop != "" {
+			props = append(props, prop)
+		}
+	}
+
+	parseBar := pb.New(0)
+	opts := parser.OptionsForPath(filePath)
+	opts.TranslateHTMLText = *translateHTML
+	opts.FrontMatterKeys = keys
+	opts.SkipTableCodeColumns = *skipCodeColumns
+	opts.TranslateMermaidLabels = *translateMermaidLabels
+	opts.HeadingAnchors = anchor
+	opts.JSXProps = props
+	opts.Strict = *strict
+	opts.Progress = func(done, total int) {
+		parseBar.SetTotal(int64(total))
+		parseBar.SetCurrent(int64(done))
+	}
+
+	parseBar.Start()
+	doc, err := parser.Parse(bytes.NewReader(content), opts)
+	parseBar.Finish()
+	if err != nil {
+		log.Fatalf("%s:\n%v", filePath, err)
+	}
+	for _, d := range doc.Diagnostics {
+		log.Printf("%s:%s", filePath, d)
+	}
+	nodes := doc.Nodes
 
-	// コードブロックの言語を推測する
+	// フェンスで言語が指定されていないコードブロックの言語を推測する（MermaidやPlantUMLの図は除く）
 	codeBlockNodes := []*parser.Node{}
 	for _, node := range nodes {
 		switch node.Type {
 		case parser.CodeBlock:
+			if node.CodeLang != "" || node.DiagramKind != "" {
+				continue
+			}
 			codeBlockNodes = append(codeBlockNodes, node)
 		}
 	}
@@ -124,18 +237,181 @@ func main() {
 
 	targetNodes := []*parser.Node{}
 	for _, node := range nodes {
-		switch node.Type {
-		case parser.Heading, parser.Paragraph, parser.Item, parser.OrderedItem, parser.Table:
-			if !textprocesser.ContainsEnglishWords(node.Text) {
-				continue
+		if !parser.IsTranslationTarget(node) || !textprocesser.ContainsLanguage(node.Text, *source) {
+			continue
+		}
+
+		targetNodes = append(targetNodes, node)
+	}
+
+	title := parser.DocumentTitle(nodes)
+
+	// パースとコードの言語の推測は一度だけ行い、翻訳先の言語ごとに翻訳して書き出す
+	for _, languages := range pairs {
+		for _, node := range nodes {
+			node.TranslatedText = ""
+		}
+
+		log.Printf("translating %s into %s", filePath, languages.Target)
+		usage := translateNodes(db, newTranslator(languages), languages, title, targetNodes, *cacheKey, *contextSize)
+		log.Printf("%s (%s): %d requests, %d prompt tokens, %d completion tokens, %d total tokens", *provider, languages, usage.Requests, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+
+		// 翻訳でリンクや脚注のラベルが変わっていないかを確かめる
+		if err := parser.CheckReferences(nodes); err != nil {
+			log.Printf("broken references after translation (%s):\n%v", languages, err)
+		}
+		if err := parser.CheckAnchors(nodes); err != nil {
+			log.Printf("broken anchors after translation (%s):\n%v", languages, err)
+		}
+
+		// 翻訳先の数によらず translated.<lang>.md に書き出す
+		translatedMarkdown := parser.NodesToMarkdownWithMode(nodes, parser.RenderSource)
+		outFilePath := filepath.Dir(filePath) + "/translated." + languages.Target + filepath.Ext(filePath)
+		ioutil.WriteFile(outFilePath, []byte(translatedMarkdown), 0644)
+	}
+}
+
+// Nodeを翻訳してTranslatedTextに入れ、翻訳エンジンの呼び出し回数とトークン数の合計を返す
+// contextSizeが1以上なら、タイトル・見出しの階層・直前のcontextSize個の段落を文脈として翻訳エンジンに渡す
+// 段落の訳はキャッシュにあったものだけを入れる（並行して翻訳した訳を入れると実行ごとにプロンプトが変わる）
+func translateNodes(db *sql.DB, translator translate.Translator, languages translate.LanguagePair, title string, targetNodes []*parser.Node, cacheKey string, contextSize int) translate.Usage {
+	// 翻訳のキャッシュは言語の組ごとに別のテーブルにする
+	translationsTable := cacheTable("translations", languages)
+	nodeTranslationsTable := cacheTable("node_translations", languages)
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + translationsTable + ` (
+		source_text TEXT PRIMARY KEY,
+		translated_text TEXT,
+		formatted_text TEXT
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	// 見出しの階層ごとに別の翻訳を持つためのテーブル（-cache-key id のとき使う）
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + nodeTranslationsTable + ` (
+		node_id TEXT PRIMARY KEY,
+		source_text TEXT,
+		translated_text TEXT,
+		formatted_text TEXT
+	)`)
+	if err != nil {
+		panic(err)
+	}
+
+	// キャッシュに無いNodeだけを翻訳する
+	misses := []*parser.Node{}
+	cached := map[*parser.Node]string{}
+	for _, node := range targetNodes {
+		// 空白や引用符の違いでキャッシュが外れないように正規化したテキストをキーにする
+		row := db.QueryRow("SELECT formatted_text FROM "+translationsTable+" WHERE source_text = ?", parser.NormalizeText(node.Text))
+		if cacheKey == "id" {
+			row = db.QueryRow("SELECT formatted_text FROM "+nodeTranslationsTable+" WHERE node_id = ?", node.ID)
+		}
+		var formattedText string
+		err := row.Scan(&formattedText)
+		if err == sql.ErrNoRows {
+			misses = append(misses, node)
+			continue
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		node.TranslatedText = formattedText
+		cached[node] = formattedText
+	}
+
+	// インラインコードやリンク先などはプレースホルダーにして翻訳させない
+	protecteds := make([]*parser.ProtectedText, len(misses))
+	texts := make([]string, len(misses))
+	for i, node := range misses {
+		protecteds[i] = parser.ProtectInline(node.Text)
+		texts[i] = protecteds[i].Text
+	}
+
+	positions := map[*parser.Node]int{}
+	for i, node := range targetNodes {
+		positions[node] = i
+	}
+	// i番目に翻訳するNodeの文脈（直前の段落の訳はキャッシュにあれば入れる）
+	documentContext := func(i int) *translate.DocumentContext {
+		node := misses[i]
+		document := &translate.DocumentContext{Title: title}
+		for _, heading := range node.HeadingPath() {
+			document.Headings = append(document.Headings, heading.Text)
+		}
+		for _, previous := range parser.PreviousPassages(targetNodes, positions[node], contextSize) {
+			document.Previous = append(document.Previous, translate.Passage{Source: previous.Text, Translated: cached[previous]})
+		}
+		return document
+	}
+	translateContext := func(i int) context.Context {
+		if contextSize <= 0 {
+			return context.Background()
+		}
+		return translate.WithDocumentContext(context.Background(), documentContext(i))
+	}
+
+	// 訳のプレースホルダーを元に戻してキャッシュに入れる
+	save := func(node *parser.Node, protected *parser.ProtectedText, translatedText string) {
+		sourceText := node.Text
+		formattedText, err := protected.Restore(strings.TrimLeft(translatedText, "\n"))
+		if err != nil {
+			// プレースホルダーが壊れた翻訳はキャッシュせず、原文のまま残す
+			log.Printf("source_text: %q: %v", sourceText, err)
+			return
+		}
+
+		node.TranslatedText = formattedText
+
+		if cacheKey == "id" {
+			_, err = db.Exec("INSERT INTO "+nodeTranslationsTable+" (node_id, source_text, translated_text, formatted_text) VALUES (?, ?, ?, ?)", node.ID, sourceText, translatedText, formattedText)
+		} else {
+			_, err = db.Exec("INSERT INTO "+translationsTable+" (source_text, translated_text, formatted_text) VALUES (?, ?, ?)", parser.NormalizeText(sourceText), translatedText, formattedText)
+		}
+		if err != nil {
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+				// キーが重複した（同じテキストや同じIDのNodeを並行して翻訳した）
+				return
+			} else {
+				log.Fatal(fmt.Errorf("source_text: %s => translated_text: %s: %v", sourceText, translatedText, err))
 			}
+		}
+	}
+
+	// 翻訳エンジンの呼び出し回数とトークン数の合計
+	var usage translate.Usage
 
-			targetNodes = append(targetNodes, node)
+	// -batch-tokens を指定したときは複数のNodeをまとめて翻訳する
+	if batch, ok := translator.(*translate.BatchTranslator); ok {
+		progressBar := pb.New(0)
+		progressBar.Start()
+		batch.Progress = func(done, total int) {
+			progressBar.SetTotal(int64(total))
+			progressBar.SetCurrent(int64(done))
 		}
+		if contextSize > 0 {
+			batch.DocumentContext = documentContext
+		}
+		result, err := batch.Translate(context.Background(), texts)
+		progressBar.Finish()
+		if result != nil {
+			usage.Add(result.Usage)
+			// 失敗したまとまりがあっても、訳せたテキストは料金がかかっているのでキャッシュに入れる
+			for i, node := range misses {
+				if result.Texts[i] != "" {
+					save(node, protecteds[i], result.Texts[i])
+				}
+			}
+		}
+		if err != nil {
+			panic(err)
+		}
+		return usage
 	}
 
+	var usageMu sync.Mutex
 	var wg sync.WaitGroup
-	totalTasks := len(targetNodes)
+	totalTasks := len(misses)
 	wg.Add(totalTasks)
 
 	semaphore := make(chan struct{}, 10) // セマフォを作成し、最大10個のゴルーチンを同時に実行
@@ -143,65 +419,24 @@ func main() {
 	// プログレスバーの初期化
 	progressBar := pb.StartNew(totalTasks)
 
-	for _, node := range targetNodes {
-		node := node
-		sourceText := node.Text
+	for i, node := range misses {
+		i, node := i, node
 		go func() {
 			semaphore <- struct{}{} // セマフォに値を追加してゴルーチン数を増やす
 			defer wg.Done()
 			defer func() { <-semaphore }() // ゴルーチン終了時にセマフォから値を取り除く
 
-			row := db.QueryRow("SELECT formatted_text FROM translations WHERE source_text = ?", sourceText)
-			var formattedText string
-			err := row.Scan(&formattedText)
-
-			if err == sql.ErrNoRows {
-				// translatedText, err = translate.Translate(sourceText)
-				// if err != nil {
-				// 	log.Fatal(err)
-				// }
-
-				gptInputStr, err := generator.GenerateGptInputString(node.Text)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				req := &gpt35.Request{
-					Model: gpt35.ModelGpt35Turbo,
-					Messages: []*gpt35.Message{
-						{
-							Role:    gpt35.RoleUser,
-							Content: gptInputStr,
-						},
-					},
-				}
-
-				resp, err := c.GetChat(req)
-				if err != nil {
-					panic(err)
-				}
-
-				translatedText := resp.Choices[0].Message.Content
-				formattedText := strings.TrimLeft(translatedText, "\n")
-
-				node.TranslatedText = formattedText
-
-				_, err = db.Exec("INSERT INTO translations (source_text, translated_text, formatted_text) VALUES (?, ?, ?)", sourceText, translatedText, formattedText)
-				if err != nil {
-					var sqliteErr sqlite3.Error
-					if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-						// source_text列の値が重複した
-						return
-					} else {
-						log.Fatal(fmt.Errorf("source_text: %s => translated_text: %s: %v", sourceText, translatedText, err))
-					}
-				}
-			} else if err != nil {
-				log.Fatal(err)
-			} else {
-				node.TranslatedText = formattedText
+			result, err := translator.Translate(translateContext(i), []string{texts[i]})
+			if result != nil {
+				usageMu.Lock()
+				usage.Add(result.Usage)
+				usageMu.Unlock()
+			}
+			if err != nil {
+				panic(err)
 			}
 
+			save(node, protecteds[i], result.Texts[0])
 			progressBar.Increment()
 		}()
 	}
@@ -210,8 +445,13 @@ func main() {
 
 	// プログレスバーを終了
 	progressBar.Finish()
+	return usage
+}
 
-	translatedMarkdown := parser.NodesToMarkdown(nodes)
-	outFilePath := filepath.Dir(filePath) + "/translated.md"
-	ioutil.WriteFile(outFilePath, []byte(translatedMarkdown), 0644)
+// 言語の組ごとのキャッシュのテーブル名（en→jaは以前からのテーブルをそのまま使う）
+func cacheTable(name string, languages translate.LanguagePair) string {
+	if languages == translate.DefaultLanguagePair {
+		return name
+	}
+	return name + "_" + strings.ReplaceAll(languages.String(), "-", "_")
 }
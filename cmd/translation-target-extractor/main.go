@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -11,12 +12,14 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: counttext <input-file>")
+	source := flag.String("source", "en", "翻訳元の言語（en, ja など）")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Println("Usage: counttext [-source en] <input-file>")
 		os.Exit(1)
 	}
 
-	filePath := os.Args[1]
+	filePath := flag.Arg(0)
 
 	// ファイルを読み込む
 	content, err := ioutil.ReadFile(filePath)
@@ -26,7 +29,7 @@ func main() {
 
 	markdownString := string(content)
 
-	nodes := parser.ParseMarkdown(markdownString)
+	nodes := parser.ParseMarkdownWithOptions(markdownString, parser.OptionsForPath(filePath))
 
 	translationTexts := ""
 	translationTextsList := []string{}
@@ -34,26 +37,27 @@ func main() {
 	currentSize := 0
 
 	for i, node := range nodes {
-		switch node.Type {
-		case parser.Heading, parser.Paragraph, parser.Item, parser.OrderedItem, parser.Table:
-			isContain := textprocesser.ContainsEnglishWords(node.Text)
-
-			if isContain {
-				newText := fmt.Sprintf("[%d]%s\n", i, node.Text)
-				newSize := len(newText)
-
-				if currentSize+newSize > byteLimit {
-					// Save the current translationTexts and reset
-					translationTextsList = append(translationTextsList, translationTexts)
-					translationTexts = ""
-					currentSize = 0
-				}
-
-				translationTexts += newText
-				currentSize += newSize
-			} else {
-				fmt.Println(node.Text)
+		if !parser.IsTranslationTarget(node) {
+			continue
+		}
+
+		isContain := textprocesser.ContainsLanguage(node.Text, *source)
+
+		if isContain {
+			newText := fmt.Sprintf("[%d]%s\n", i, node.Text)
+			newSize := len(newText)
+
+			if currentSize+newSize > byteLimit {
+				// Save the current translationTexts and reset
+				translationTextsList = append(translationTextsList, translationTexts)
+				translationTexts = ""
+				currentSize = 0
 			}
+
+			translationTexts += newText
+			currentSize += newSize
+		} else {
+			fmt.Printf("%s:%s %s\n", filePath, node.Position(), node.Text)
 		}
 	}
 
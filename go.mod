@@ -3,10 +3,10 @@ module github.com/sofuetakuma112/go-markdown-translater
 go 1.20
 
 require (
-	github.com/cheggaaa/pb v1.0.29
 	github.com/cheggaaa/pb/v3 v3.1.2
 	github.com/gomarkdown/markdown v0.0.0-20230313173142-2ced44d5b584
 	github.com/joho/godotenv v1.5.1
+	github.com/mattn/go-runewidth v0.0.12
 	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/yuin/goldmark v1.5.4
 	golang.org/x/net v0.0.0-20200602114024-627f9648deb9
@@ -17,7 +17,6 @@ require (
 	github.com/fatih/color v1.14.1 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
-	github.com/mattn/go-runewidth v0.0.12 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	golang.org/x/sys v0.5.0 // indirect
 )
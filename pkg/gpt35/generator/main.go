@@ -2,25 +2,73 @@ package generator
 
 import (
 	"bytes"
+	"fmt"
+	"os"
 	"text/template"
 )
 
 type Data struct {
-	Text string
+	Text           string
+	SourceLanguage string // 翻訳元の言語の名前（English）
+	TargetLanguage string // 翻訳先の言語の名前（Japanese）
+}
+
+// テンプレートで使う言語の名前
+var languageNames = map[string]string{
+	"en": "English",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"zh": "Chinese",
+	"fr": "French",
+	"de": "German",
+	"es": "Spanish",
+	"pt": "Portuguese",
+	"it": "Italian",
+	"ru": "Russian",
+}
+
+// 言語のコードから名前を返す（知らないコードはそのまま返す）
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
 }
 
 func GenerateGptInputString(text string) (string, error) {
+	return GenerateGptInputStringFor(text, "en", "ja")
+}
+
+// どのテンプレートを使うときもプロンプトの先頭に付ける指示
+// （プレースホルダーが抜けたり番号が変わったりすると訳を元に戻せない）
+const PlaceholderInstruction = "The text may contain placeholders such as ⟦0⟧ that stand for code, links and tags. Keep every placeholder exactly as it is, without translating, renumbering or dropping it.\n\n"
+
+// 言語の組のテンプレートがないときに使うプロンプト
+const DefaultTemplate = `Translate the following Markdown text from {{.SourceLanguage}} into {{.TargetLanguage}}.
+Keep the Markdown syntax exactly as it is, and output only the translation.
+
+{{.Text}}
+`
+
+// テンプレートは次の順に探す
+//   - templates/translate.<source>-<target>.txt
+//   - en→jaなら templates/translate.txt（英日の翻訳のために書かれたテンプレート）
+//   - どちらもなければ言語の名前を埋め込むDefaultTemplate
+//
+// テンプレートを書き出したものの前にPlaceholderInstructionを付ける
+func GenerateGptInputStringFor(text, source, target string) (string, error) {
 	data := Data{
-		Text: text,
+		Text:           text,
+		SourceLanguage: LanguageName(source),
+		TargetLanguage: LanguageName(target),
 	}
 
-	templatePath := "templates/translate.txt"
-	tmpl, err := template.ParseFiles(templatePath)
+	tmpl, err := loadTemplate(source, target)
 	if err != nil {
 		return "", err
 	}
 
-	buf := []byte{}
+	buf := []byte(PlaceholderInstruction)
 	outputData := bytes.NewBuffer(buf)
 	err = tmpl.Execute(outputData, data)
 	if err != nil {
@@ -29,3 +77,16 @@ func GenerateGptInputString(text string) (string, error) {
 
 	return outputData.String(), nil
 }
+
+func loadTemplate(source, target string) (*template.Template, error) {
+	paths := []string{fmt.Sprintf("templates/translate.%s-%s.txt", source, target)}
+	if source == "en" && target == "ja" {
+		paths = append(paths, "templates/translate.txt")
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return template.ParseFiles(path)
+		}
+	}
+	return template.New("default").Parse(DefaultTemplate)
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGptInputStringFor(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "templates", "translate.txt"), []byte("英語を日本語に訳す: {{.Text}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// en→jaは以前からのテンプレートを使う
+	if prompt, err := GenerateGptInputStringFor("Hello", "en", "ja"); err != nil || prompt != PlaceholderInstruction+"英語を日本語に訳す: Hello" {
+		t.Errorf("unexpected en-ja prompt %q: %v", prompt, err)
+	}
+
+	// 英日のテンプレートを他の言語の組に使わない
+	prompt, err := GenerateGptInputStringFor("Hello", "en", "ko")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "from English into Korean") || !strings.Contains(prompt, "Hello") {
+		t.Errorf("unexpected en-ko prompt %q", prompt)
+	}
+	// プレースホルダーの指示はどのテンプレートでも1回だけ入る
+	if strings.Count(prompt, "⟦0⟧") != 1 || !strings.HasPrefix(prompt, PlaceholderInstruction) {
+		t.Errorf("placeholder instruction is missing or repeated in %q", prompt)
+	}
+}
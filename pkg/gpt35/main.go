@@ -2,6 +2,7 @@ package gpt35
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 )
@@ -41,12 +42,17 @@ func NewClientCustomUrl(apiKey string, url string) *Client {
 }
 
 func (c *Client) GetChat(r *Request) (*Response, error) {
+	return c.GetChatContext(context.Background(), r)
+}
+
+// ctxがキャンセルされたらリクエストを中断する
+func (c *Client) GetChatContext(ctx context.Context, r *Request) (*Response, error) {
 	jsonData, err := json.Marshal(r)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", c.url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
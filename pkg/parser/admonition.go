@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	// !!! note "タイトル" / ??? note（MkDocs）
+	mkdocsAdmonitionPattern = regexp.MustCompile(`^ {0,3}(?:!!!|\?\?\?\+?)[ \t]+([A-Za-z][\w-]*)(?:[ \t]+"([^"]*)")?[ \t]*\r?\n?$`)
+	// :::tip タイトル / :::tip[タイトル]（Docusaurus）
+	docusaurusAdmonitionPattern = regexp.MustCompile(`^ {0,3}(:{3,})[ \t]*([A-Za-z][\w-]*)(?:\[((?:\\.|[^\]\\])*)\]|[ \t]+([^\r\n]*?))?[ \t]*\r?\n?$`)
+	// > [!NOTE]（GitHub）
+	githubAlertPattern = regexp.MustCompile(`^\[!([A-Za-z]+)\]\s*$`)
+)
+
+var kindAdmonitionBlock = ast.NewNodeKind("AdmonitionBlock")
+
+// MkDocsとDocusaurusのアドモニションを表すgoldmarkのブロック
+type admonitionBlock struct {
+	ast.BaseBlock
+	kind        string
+	title       text.Segment
+	hasTitle    bool
+	opener      text.Segment // 開始行
+	closer      text.Segment // Docusaurusの終了行
+	closed      bool
+	fenceLength int // Docusaurusの ::: の数（MkDocsは0）
+}
+
+func (n *admonitionBlock) Kind() ast.NodeKind {
+	return kindAdmonitionBlock
+}
+
+func (n *admonitionBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Kind": n.kind}, nil)
+}
+
+func newAdmonitionBlock(kind string, opener text.Segment) *admonitionBlock {
+	return &admonitionBlock{kind: kind, opener: opener}
+}
+
+// 改行を残して行の残りを読み進める
+func advanceLine(reader text.Reader, line []byte, segment text.Segment) {
+	newline := 0
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		newline = 1
+	}
+	reader.Advance(segment.Len() - newline)
+}
+
+type mkdocsAdmonitionParser struct {
+}
+
+func (p *mkdocsAdmonitionParser) Trigger() []byte {
+	return []byte{'!', '?'}
+}
+
+func (p *mkdocsAdmonitionParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	m := mkdocsAdmonitionPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, gparser.NoChildren
+	}
+
+	node := newAdmonitionBlock(string(line[m[2]:m[3]]), segment)
+	if m[4] >= 0 {
+		node.title = text.NewSegment(segment.Start+m[4]-segment.Padding, segment.Start+m[5]-segment.Padding)
+		node.hasTitle = true
+	}
+	advanceLine(reader, line, segment)
+	return node, gparser.HasChildren
+}
+
+// 本文は4つ以上インデントされた行が続く間
+func (p *mkdocsAdmonitionParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	line, _ := reader.PeekLine()
+	if util.IsBlank(line) {
+		reader.Advance(len(line) - 1)
+		return gparser.Continue | gparser.HasChildren
+	}
+
+	indent, _ := util.IndentWidth(line, reader.LineOffset())
+	if indent < 4 {
+		return gparser.Close
+	}
+	pos, padding := util.IndentPosition(line, reader.LineOffset(), 4)
+	reader.AdvanceAndSetPadding(pos, padding)
+	return gparser.Continue | gparser.HasChildren
+}
+
+func (p *mkdocsAdmonitionParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *mkdocsAdmonitionParser) CanInterruptParagraph() bool {
+	return false
+}
+
+func (p *mkdocsAdmonitionParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type docusaurusAdmonitionParser struct {
+}
+
+func (p *docusaurusAdmonitionParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p *docusaurusAdmonitionParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	m := docusaurusAdmonitionPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, gparser.NoChildren
+	}
+
+	node := newAdmonitionBlock(string(line[m[4]:m[5]]), segment)
+	node.fenceLength = m[3] - m[2]
+	for i := 6; i <= 8; i += 2 {
+		if m[i] >= 0 && m[i+1] > m[i] {
+			node.title = text.NewSegment(segment.Start+m[i]-segment.Padding, segment.Start+m[i+1]-segment.Padding)
+			node.hasTitle = true
+		}
+	}
+	advanceLine(reader, line, segment)
+	return node, gparser.HasChildren
+}
+
+// 開始と同じ数以上の ::: だけの行で閉じる
+func (p *docusaurusAdmonitionParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	admonition := node.(*admonitionBlock)
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(util.TrimLeftSpace(line))
+	if len(trimmed) >= admonition.fenceLength && len(bytes.Trim(trimmed, ":")) == 0 {
+		admonition.closer = segment
+		admonition.closed = true
+		advanceLine(reader, line, segment)
+		return gparser.Close
+	}
+	return gparser.Continue | gparser.HasChildren
+}
+
+func (p *docusaurusAdmonitionParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *docusaurusAdmonitionParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *docusaurusAdmonitionParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func admonitionBlockParsers() []util.PrioritizedValue {
+	return []util.PrioritizedValue{
+		util.Prioritized(&mkdocsAdmonitionParser{}, 750),
+		util.Prioritized(&docusaurusAdmonitionParser{}, 750),
+	}
+}
+
+// 翻訳したタイトルが開始行を壊さないようにする
+//   - MkDocsの "タイトル" の " は &quot; にする
+//   - Docusaurusの [タイトル] の括弧はバックスラッシュでエスケープする
+//   - どちらも改行は空白にする
+func escapeMkDocsTitle(s string) string {
+	return strings.NewReplacer("\n", " ", `"`, "&quot;").Replace(s)
+}
+
+func escapeDocusaurusLabel(s string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			escaped.WriteByte(c)
+			if i+1 < len(s) {
+				i++
+				escaped.WriteByte(s[i])
+			}
+		case '[', ']':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(c)
+		case '\n':
+			escaped.WriteByte(' ')
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+func escapeAdmonitionTitle(s string) string {
+	return strings.ReplaceAll(s, "\n", " ")
+}
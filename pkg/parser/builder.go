@@ -0,0 +1,865 @@
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ソース上の1行分のバイト範囲（endは改行文字の位置）
+type sourceLine struct {
+	start int
+	end   int
+}
+
+// goldmarkのASTを走査してNodeのスライスを組み立てる
+type nodeBuilder struct {
+	source     []byte
+	lines      []sourceLine
+	next       int // まだどのNodeにも割り当てられていない最初の行
+	root       *Node
+	parent     *Node // 現在Nodeを追加しているコンテナ
+	quoteDepth int   // 現在の引用の深さ
+	opts       Options
+	onProgress func(line int)
+
+	diagnostics []Diagnostic
+}
+
+var (
+	orderedItemNumPattern        = regexp.MustCompile(`(\d+)[.)]\s*$`)
+	leadingOrderedItemNumPattern = regexp.MustCompile(`^[\s>]*(\d+)[.)]`)
+	taskCheckBoxPattern          = regexp.MustCompile(`^\[[ xX]\]\s*`)
+	quoteMarkerPattern           = regexp.MustCompile(`^ {0,3}> ?`)
+	headingAttributePattern      = regexp.MustCompile(`\{[^{}]*\}\s*$`)
+	explicitIDPattern            = regexp.MustCompile(`(?:^\{|\s)(?:#[^\s}]|id=)`)
+)
+
+func newMarkdown(extensions Extension, blockExtensions []BlockExtension) goldmark.Markdown {
+	var markdownExtensions []goldmark.Extender
+	if extensions&ExtTable != 0 {
+		markdownExtensions = append(markdownExtensions, extension.Table)
+	}
+	if extensions&ExtTaskList != 0 {
+		markdownExtensions = append(markdownExtensions, extension.TaskList)
+	}
+	if extensions&ExtDefinitionList != 0 {
+		markdownExtensions = append(markdownExtensions, extension.DefinitionList)
+	}
+	// 見出しのアンカーは翻訳前のテキストからgoldmarkと同じ方法で作る
+	parserOptions := []gparser.Option{gparser.WithBlockParsers(blockParsers(extensions, blockExtensions)...), gparser.WithAutoHeadingID()}
+	if extensions&ExtHeadingAttribute != 0 {
+		parserOptions = append(parserOptions, gparser.WithHeadingAttribute())
+	}
+	return goldmark.New(
+		goldmark.WithExtensions(markdownExtensions...),
+		goldmark.WithParserOptions(parserOptions...),
+	)
+}
+
+func blockParsers(extensions Extension, blockExtensions []BlockExtension) []util.PrioritizedValue {
+	var parsers []util.PrioritizedValue
+	if extensions&ExtAdmonition != 0 {
+		parsers = append(parsers, admonitionBlockParsers()...)
+	}
+	if extensions&ExtFootnote != 0 {
+		parsers = append(parsers, footnoteBlockParsers()...)
+	}
+	if extensions&ExtMath != 0 {
+		parsers = append(parsers, mathBlockParsers()...)
+	}
+	if extensions&ExtMDX != 0 {
+		parsers = append(parsers, mdxBlockParsers()...)
+	}
+	if extensions&ExtAbbreviation != 0 {
+		parsers = append(parsers, abbreviationParsers()...)
+	}
+	parsers = append(parsers, customBlockParsers(blockExtensions)...)
+	return parsers
+}
+
+func newNodeBuilder(source []byte, opts Options) *nodeBuilder {
+	if opts.Extensions == 0 {
+		opts.Extensions = DefaultExtensions
+	}
+	b := &nodeBuilder{source: source, root: &Node{Type: Root, container: true}, opts: opts}
+	b.parent = b.root
+	start := 0
+	for i, ch := range source {
+		if ch == '\n' {
+			b.lines = append(b.lines, sourceLine{start: start, end: i})
+			start = i + 1
+		}
+	}
+	b.lines = append(b.lines, sourceLine{start: start, end: len(source)})
+	return b
+}
+
+func (b *nodeBuilder) build() *Node {
+	source := b.source
+	if format, last := findFrontMatter(b); format != NoFrontMatter && b.opts.Extensions&ExtFrontMatter != 0 {
+		b.emitFrontMatter(format, last)
+		// 位置がずれないようにフロントマターを空白に置き換えてからgoldmarkに渡す
+		source = make([]byte, len(b.source))
+		copy(source, b.source)
+		for i := 0; i < b.lines[last].end; i++ {
+			if source[i] != '\n' {
+				source[i] = ' '
+			}
+		}
+	}
+
+	doc := newMarkdown(b.opts.Extensions, b.opts.BlockExtensions).Parser().Parse(text.NewReader(source))
+	b.walkChildren(doc)
+	b.flush(len(b.lines))
+	b.root.End = len(b.source)
+	return b.root
+}
+
+func (b *nodeBuilder) walkChildren(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		b.walk(c)
+	}
+}
+
+func (b *nodeBuilder) walk(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Blockquote:
+		b.walkBlockquote(n)
+	case *admonitionBlock:
+		b.walkAdmonition(n)
+	case *footnoteBlock:
+		b.walkFootnote(n)
+	case *mathBlock:
+		b.walkMathBlock(n)
+	case *mdxBlock:
+		b.walkMDXBlock(n)
+	case *east.DefinitionList:
+		b.walkDefinitionList(n)
+	case *abbreviationBlock:
+		b.walkAbbreviation(n)
+	case *customBlock:
+		b.walkCustomBlock(n)
+	case *ast.List:
+		b.walkList(n)
+	case *ast.Heading:
+		b.walkHeading(n)
+	case *ast.Paragraph, *ast.TextBlock:
+		b.walkParagraph(n)
+	case *ast.FencedCodeBlock:
+		b.walkFencedCodeBlock(n)
+	case *east.Table:
+		b.walkTable(n)
+	case *ast.ThematicBreak:
+		b.walkThematicBreak()
+	case *ast.CodeBlock:
+		b.walkIndentedCodeBlock(n)
+	case *ast.HTMLBlock:
+		b.walkHTMLBlock(n)
+	default:
+		// 水平線などは翻訳せずそのまま残す
+		first, last, ok := b.segmentsRange(n.Lines())
+		if !ok {
+			first = b.firstNonBlankLine()
+			last = first
+		}
+		b.emitOther(first, last)
+	}
+}
+
+func (b *nodeBuilder) walkList(n *ast.List) {
+	b.flush(b.firstNonBlankLine())
+
+	node := Node{
+		Type:      List,
+		ListStart: n.Start,
+		ListTight: n.IsTight,
+	}
+	if n.IsOrdered() {
+		node.ListDelimiter = n.Marker
+	} else {
+		node.ListMarker = n.Marker
+	}
+
+	list := b.openContainer(node)
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		b.walkListItem(list, item)
+	}
+	b.closeContainer(list)
+}
+
+func (b *nodeBuilder) walkListItem(list *Node, item ast.Node) {
+	node := Node{
+		Type:          Item,
+		ListMarker:    list.ListMarker,
+		ListDelimiter: list.ListDelimiter,
+		ListStart:     list.ListStart,
+		ListTight:     list.ListTight,
+	}
+	if list.ListDelimiter != 0 {
+		node.Type = OrderedItem
+	}
+
+	first := item.FirstChild()
+	start, last, ok := 0, 0, false
+	if first != nil && isTextBlock(first) {
+		start, last, ok = b.segmentsRange(first.Lines())
+	}
+	if !ok {
+		// 先頭がパラグラフでない要素は子要素だけを持つコンテナにする
+		container := b.openContainer(node)
+		b.walkChildren(item)
+		b.closeContainer(container)
+
+		if container.End > container.Start {
+			line := b.lineText(b.lineOf(container.Start))
+			container.NestSpaceCount = b.nestSpaceCount(b.lineOf(container.Start))
+			if m := leadingOrderedItemNumPattern.FindStringSubmatch(line); m != nil && node.Type == OrderedItem {
+				container.OrderedItemNum = b.orderedItemNum(m[1], container.Start)
+			}
+		}
+		return
+	}
+
+	node.Text = b.segmentsText(first.Lines())
+	node.NestSpaceCount = b.nestSpaceCount(start)
+	node.TextStart, node.TextEnd = b.segmentsSpan(first.Lines())
+	if node.Type == OrderedItem {
+		prefix := string(b.source[b.lines[start].start:first.Lines().At(0).Start])
+		if m := orderedItemNumPattern.FindStringSubmatch(prefix); m != nil {
+			node.OrderedItemNum = b.orderedItemNum(m[1], b.lines[start].start)
+		}
+	}
+
+	// タスクリストのチェックボックスは翻訳の対象に含めない
+	if checkBox, ok := first.FirstChild().(*east.TaskCheckBox); ok {
+		node.Task = TaskUnchecked
+		if checkBox.IsChecked {
+			node.Task = TaskChecked
+		}
+		if m := taskCheckBoxPattern.FindString(node.Text); m != "" {
+			node.Text = node.Text[len(m):]
+		}
+		if m := taskCheckBoxPattern.FindString(string(b.source[node.TextStart:node.TextEnd])); m != "" {
+			node.TextStart += len(m)
+		}
+	}
+
+	parent := b.parent
+	if itemNode := b.emit(node, start, last); itemNode != nil {
+		b.parent = itemNode
+	}
+	for c := first.NextSibling(); c != nil; c = c.NextSibling() {
+		b.walk(c)
+	}
+	b.parent = parent
+}
+
+// 番号付きリストの番号を読む（読めなければリストの開始番号を使う）
+func (b *nodeBuilder) orderedItemNum(s string, pos int) int {
+	num, err := strconv.Atoi(s)
+	if err != nil {
+		b.diagnose(pos, "cannot parse ordered list number %q: %v", s, err)
+		return b.parent.ListStart
+	}
+	return num
+}
+
+// ソースの行を持たないコンテナを追加し、以降のNodeをその子として追加する
+func (b *nodeBuilder) openContainer(node Node) *Node {
+	node.container = true
+	container := createNewNodeWithIndex(node, b.next)
+	b.appendNode(container)
+	b.parent = container
+	return container
+}
+
+func (b *nodeBuilder) closeContainer(container *Node) {
+	b.parent = container.parent
+	if b.parent == nil {
+		b.parent = b.root
+	}
+
+	// 子要素が占める範囲をコンテナの範囲とする
+	var descendants []*Node
+	for _, child := range container.Children {
+		descendants = append(descendants, Flatten(child)...)
+	}
+	if len(descendants) == 0 {
+		container.Start, container.End = b.lines[container.Index].start, b.lines[container.Index].start
+	} else {
+		container.Index = descendants[0].Index
+		container.Start = descendants[0].Start
+		container.End = descendants[len(descendants)-1].End
+	}
+	container.TextStart, container.TextEnd = container.Start, container.Start
+}
+
+func (b *nodeBuilder) walkHeading(n *ast.Heading) {
+	setext := false
+	first, last, ok := b.segmentsRange(n.Lines())
+	if !ok {
+		// "#" だけの空の見出し
+		first = b.firstNonBlankLine()
+		last = first
+	} else if !strings.Contains(string(b.source[b.lines[first].start:n.Lines().At(0).Start]), "#") {
+		// Setext見出しは下線の行までを範囲に含める
+		last = b.lineOf(n.Lines().At(n.Lines().Len()-1).Start) + 1
+		setext = true
+	}
+
+	textStart, textEnd := b.segmentsSpan(n.Lines())
+	var id, attribute string
+	if value, found := n.AttributeString("id"); found {
+		id = string(value.([]byte))
+	}
+	if ok {
+		// 見出しの行の後ろに書かれた {#id .class}
+		lineEnd := b.lines[b.lineOf(textEnd)].end
+		if m := headingAttributePattern.FindString(string(b.source[textEnd:lineEnd])); m != "" {
+			attribute = strings.TrimSpace(m)
+		}
+	}
+
+	b.emit(Node{
+		Type:             Heading,
+		Text:             b.segmentsText(n.Lines()),
+		HeadingLevel:     n.Level,
+		HeadingID:        id,
+		HeadingAttribute: attribute,
+		SetextHeading:    setext,
+		NestSpaceCount:   b.nestSpaceCount(first),
+		TextStart:        textStart,
+		TextEnd:          textEnd,
+		anchor:           b.headingAnchor(id, attribute),
+	}, first, last)
+}
+
+// 翻訳した見出しの後ろに書き足すアンカー（明示的なIDがあれば書き足さない）
+func (b *nodeBuilder) headingAnchor(id, attribute string) string {
+	if id == "" || explicitIDPattern.MatchString(attribute) {
+		return ""
+	}
+	switch b.opts.HeadingAnchors {
+	case AnchorAttribute:
+		if attribute == "" {
+			return " {#" + id + "}"
+		}
+		// 属性リストは1つしか書けないのでHTMLのアンカーにする
+		return ` <a id="` + id + `"></a>`
+	case AnchorHTML:
+		return ` <a id="` + id + `"></a>`
+	}
+	return ""
+}
+
+// 水平線は翻訳しない（記号の種類はTextに残す）
+func (b *nodeBuilder) walkThematicBreak() {
+	line := b.firstNonBlankLine()
+	b.emit(Node{
+		Type:           ThematicBreak,
+		Text:           strings.TrimSpace(b.stripQuote(b.lineText(line))),
+		NestSpaceCount: b.nestSpaceCount(line),
+		TextStart:      b.lines[line].end,
+		TextEnd:        b.lines[line].end,
+	}, line, line)
+}
+
+func (b *nodeBuilder) walkParagraph(n ast.Node) {
+	b.emitParagraph(n, n.Lines())
+}
+
+func (b *nodeBuilder) emitParagraph(n ast.Node, segments *text.Segments) {
+	first, last, ok := b.segmentsRange(segments)
+	if !ok {
+		return
+	}
+
+	nestSpaceCount := b.nestSpaceCount(first)
+	textStart, textEnd := b.segmentsSpan(segments)
+	text := b.segmentsText(segments)
+
+	if isImageOnly(n, b.source) {
+		b.emit(Node{Type: Image, Text: text, NestSpaceCount: nestSpaceCount, TextStart: textStart, TextEnd: textEnd}, first, last)
+		return
+	}
+
+	b.emit(Node{Type: Paragraph, Text: text, NestSpaceCount: nestSpaceCount, TextStart: textStart, TextEnd: textEnd}, first, last)
+}
+
+func (b *nodeBuilder) walkBlockquote(n *ast.Blockquote) {
+	b.flush(b.firstNonBlankLine())
+
+	quote := b.openContainer(Node{Type: Blockquote})
+	b.quoteDepth++
+
+	// GitHubのアラート（> [!NOTE]）はキーワードの行をAdmonitionにして残りをその子にする
+	first := n.FirstChild()
+	if first != nil && isTextBlock(first) && first.Lines().Len() > 0 {
+		segment := first.Lines().At(0)
+		if m := githubAlertPattern.FindStringSubmatch(string(segment.Value(b.source))); m != nil {
+			line := b.lineOf(segment.Start)
+			alert := b.emit(Node{
+				Type:           Admonition,
+				AdmonitionKind: m[1],
+				NestSpaceCount: b.nestSpaceCount(line),
+				TextStart:      b.lines[line].end,
+				TextEnd:        b.lines[line].end,
+			}, line, line)
+			if alert != nil {
+				b.parent = alert
+			}
+
+			rest := text.NewSegments()
+			for i := 1; i < first.Lines().Len(); i++ {
+				rest.Append(first.Lines().At(i))
+			}
+			b.emitParagraph(first, rest)
+			for c := first.NextSibling(); c != nil; c = c.NextSibling() {
+				b.walk(c)
+			}
+			b.parent = quote
+			first = nil
+		}
+	}
+	if first != nil {
+		b.walkChildren(n)
+	}
+
+	b.quoteDepth--
+	b.closeContainer(quote)
+}
+
+// MkDocsやDocusaurusのアドモニションは開始行をAdmonitionにして本文をその子にする
+func (b *nodeBuilder) walkAdmonition(n *admonitionBlock) {
+	b.flush(b.firstNonBlankLine())
+
+	line := b.lineOf(n.opener.Start)
+	node := Node{
+		Type:           Admonition,
+		AdmonitionKind: n.kind,
+		NestSpaceCount: b.nestSpaceCount(line),
+		TextStart:      b.lines[line].end,
+		TextEnd:        b.lines[line].end,
+	}
+	if n.hasTitle {
+		node.Text = string(n.title.Value(b.source))
+		node.TextStart, node.TextEnd = n.title.Start, n.title.Stop
+		switch {
+		case n.fenceLength == 0:
+			node.escape = escapeMkDocsTitle
+		case n.title.Start > 0 && b.source[n.title.Start-1] == '[':
+			node.escape = escapeDocusaurusLabel
+		default:
+			node.escape = escapeAdmonitionTitle
+		}
+	}
+
+	parent := b.parent
+	if admonition := b.emit(node, line, line); admonition != nil {
+		b.parent = admonition
+	}
+	b.walkChildren(n)
+	if n.closed {
+		closer := b.lineOf(n.closer.Start)
+		b.emitOther(closer, closer)
+	} else if n.fenceLength > 0 {
+		b.diagnose(n.opener.Start, "admonition %q is not closed", n.kind)
+	}
+	b.parent = parent
+}
+
+func (b *nodeBuilder) walkFencedCodeBlock(n *ast.FencedCodeBlock) {
+	var first, last int
+	if contentFirst, contentLast, ok := b.segmentsRange(n.Lines()); ok {
+		first, last = contentFirst-1, contentLast
+	} else if n.Info != nil {
+		first = b.lineOf(n.Info.Segment.Start)
+		last = first
+	} else {
+		first = b.firstNonBlankLine()
+		last = first
+	}
+
+	fence := codeFence(b.lineText(first))
+	if last+1 < len(b.lines) && isClosingFence(b.lineText(last+1), fence) {
+		last++
+	} else if fence != "" {
+		b.diagnose(b.lines[first].start, "code fence %q is not closed", fence)
+	}
+
+	var info, lang string
+	if n.Info != nil {
+		info = strings.TrimSpace(string(n.Info.Segment.Value(b.source)))
+		lang = string(n.Language(b.source))
+	}
+
+	var code strings.Builder
+	for i := 0; i < n.Lines().Len(); i++ {
+		segment := n.Lines().At(i)
+		code.Write(segment.Value(b.source))
+	}
+
+	textStart, textEnd := b.lines[first].end, b.lines[first].end
+	if n.Lines().Len() > 0 {
+		textStart, textEnd = b.lines[first+1].start, b.lines[b.lineOf(n.Lines().At(n.Lines().Len()-1).Start)].end
+	}
+	node := Node{
+		Type:           CodeBlock,
+		Text:           strings.TrimSuffix(code.String(), "\n"),
+		NestSpaceCount: b.nestSpaceCount(first),
+		TextStart:      textStart,
+		TextEnd:        textEnd,
+		CodeLang:       lang,
+		CodeInfo:       info,
+		CodeAttributes: strings.TrimSpace(strings.TrimPrefix(info, lang)),
+		DiagramKind:    diagramKind(lang, code.String()),
+	}
+	if fence != "" {
+		node.CodeFenceChar = fence[0]
+		node.CodeFenceLength = len(fence)
+	}
+	codeBlock := b.emit(node, first, last)
+	if codeBlock != nil && codeBlock.DiagramKind == "mermaid" && b.opts.TranslateMermaidLabels {
+		b.mermaidLabels(codeBlock, n.Lines())
+	}
+}
+
+func (b *nodeBuilder) walkIndentedCodeBlock(n *ast.CodeBlock) {
+	first, last, ok := b.segmentsRange(n.Lines())
+	if !ok {
+		return
+	}
+
+	var code strings.Builder
+	for i := 0; i < n.Lines().Len(); i++ {
+		segment := n.Lines().At(i)
+		code.Write(segment.Value(b.source))
+	}
+
+	nestSpaceCount := b.nestSpaceCount(first) - 4
+	if nestSpaceCount < 0 {
+		nestSpaceCount = 0
+	}
+	textStart, textEnd := b.trimmedSpan(first, last)
+	b.emit(Node{
+		Type:           IndentedCode,
+		Text:           strings.TrimSuffix(code.String(), "\n"),
+		NestSpaceCount: nestSpaceCount,
+		TextStart:      textStart,
+		TextEnd:        textEnd,
+	}, first, last)
+}
+
+func (b *nodeBuilder) walkHTMLBlock(n *ast.HTMLBlock) {
+	first, last, ok := b.segmentsRange(n.Lines())
+	if !ok {
+		return
+	}
+	if n.HasClosure() {
+		last = b.lineOf(n.ClosureLine.Start)
+	}
+
+	var texts []string
+	for i := first; i <= last; i++ {
+		texts = append(texts, b.lineText(i))
+	}
+
+	textStart, textEnd := b.trimmedSpan(first, last)
+	node := b.emit(Node{
+		Type:           HTMLBlock,
+		Text:           strings.Join(texts, "\n"),
+		NestSpaceCount: b.nestSpaceCount(first),
+		TextStart:      textStart,
+		TextEnd:        textEnd,
+	}, first, last)
+
+	if node != nil && b.opts.TranslateHTMLText {
+		for _, fragment := range htmlTextFragments(node) {
+			fragment.parent = node
+			node.Children = append(node.Children, fragment)
+		}
+	}
+}
+
+func (b *nodeBuilder) walkTable(n *east.Table) {
+	first := b.firstNonBlankLine()
+	last := first
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			if cell.Lines().Len() > 0 {
+				last = b.lineOf(cell.Lines().At(0).Start)
+				break
+			}
+		}
+	}
+	// 見出しの行だけの表でも区切りの行までを表とする
+	if last < first+1 {
+		last = first + 1
+	}
+
+	var rows []string
+	for i := first; i <= last; i++ {
+		rows = append(rows, strings.TrimSpace(b.stripQuote(b.lineText(i))))
+	}
+
+	textStart, textEnd := b.trimmedSpan(first, last)
+	textStart += len(b.lineText(first)) - len(b.stripQuote(b.lineText(first)))
+	node := b.emit(Node{
+		Type:           Table,
+		Text:           strings.Join(rows, "\n"),
+		NestSpaceCount: b.nestSpaceCount(first),
+		TextStart:      textStart,
+		TextEnd:        textEnd,
+	}, first, last)
+	if node != nil {
+		b.tableCells(node, n, first, last)
+	}
+}
+
+func (b *nodeBuilder) emitOther(first, last int) {
+	if last >= len(b.lines) {
+		last = len(b.lines) - 1
+	}
+	var texts []string
+	for i := first; i <= last; i++ {
+		texts = append(texts, b.lineText(i))
+	}
+	textStart, textEnd := b.trimmedSpan(first, last)
+	b.emit(Node{Type: Other, Text: strings.Join(texts, "\n"), TextStart: textStart, TextEnd: textEnd}, first, last)
+}
+
+// first行目からlast行目までをnodeの範囲として追加する
+func (b *nodeBuilder) emit(node Node, first, last int) *Node {
+	if first < b.next {
+		first = b.next
+	}
+	if last >= len(b.lines) {
+		last = len(b.lines) - 1
+	}
+	if last < first {
+		return nil
+	}
+
+	b.flush(first)
+
+	node.Start = b.lines[first].start
+	node.End = b.lines[last].end
+	node.Raw = string(b.source[node.Start:node.End])
+	if node.TextStart < node.Start || node.TextEnd > node.End || node.TextEnd < node.TextStart {
+		node.TextStart, node.TextEnd = node.Start, node.End
+	}
+	newNode := createNewNodeWithIndex(node, first)
+	b.appendNode(newNode)
+	b.next = last + 1
+
+	if b.onProgress != nil {
+		b.onProgress(last)
+	}
+
+	return newNode
+}
+
+func (b *nodeBuilder) appendNode(node *Node) {
+	node.parent = b.parent
+	b.parent.Children = append(b.parent.Children, node)
+}
+
+// まだ割り当てられていないuntil行目より前の行を空行とその他の要素として追加する
+func (b *nodeBuilder) flush(until int) {
+	for b.next < until {
+		if strings.TrimSpace(b.lineText(b.next)) == "" {
+			line := b.lines[b.next]
+			b.appendNode(createNewNodeWithIndex(Node{
+				Type:      Blank,
+				Start:     line.start,
+				End:       line.end,
+				TextStart: line.end,
+				TextEnd:   line.end,
+				Raw:       b.lineText(b.next),
+			}, b.next))
+			b.next++
+			continue
+		}
+
+		if b.emitLinkDefinition(b.next) {
+			continue
+		}
+
+		first, last := b.next, b.next
+		for last+1 < until && strings.TrimSpace(b.lineText(last+1)) != "" && !linkDefinitionPattern.MatchString(strings.TrimLeft(b.lineText(last+1), " >")) {
+			last++
+		}
+		b.emitOther(first, last)
+	}
+}
+
+func (b *nodeBuilder) firstNonBlankLine() int {
+	i := b.next
+	for i < len(b.lines)-1 && strings.TrimSpace(b.lineText(i)) == "" {
+		i++
+	}
+	return i
+}
+
+// 引用の中の行から引用記号を取り除く
+func (b *nodeBuilder) stripQuote(line string) string {
+	for i := 0; i < b.quoteDepth; i++ {
+		loc := quoteMarkerPattern.FindStringIndex(line)
+		if loc == nil {
+			break
+		}
+		line = line[loc[1]:]
+	}
+	return line
+}
+
+// 引用記号を除いた行頭のスペースの数
+func (b *nodeBuilder) nestSpaceCount(i int) int {
+	line := b.stripQuote(b.lineText(i))
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func (b *nodeBuilder) lineText(i int) string {
+	return string(b.source[b.lines[i].start:b.lines[i].end])
+}
+
+// posバイト目を含む行のインデックスを返す
+func (b *nodeBuilder) lineOf(pos int) int {
+	return sort.Search(len(b.lines), func(i int) bool {
+		return b.lines[i].end >= pos
+	})
+}
+
+func (b *nodeBuilder) segmentsRange(segments *text.Segments) (int, int, bool) {
+	if segments == nil || segments.Len() == 0 {
+		return 0, 0, false
+	}
+	firstSegment := segments.At(0)
+	lastSegment := segments.At(segments.Len() - 1)
+	stop := lastSegment.Stop - 1
+	if stop < lastSegment.Start {
+		stop = lastSegment.Start
+	}
+	return b.lineOf(firstSegment.Start), b.lineOf(stop), true
+}
+
+// 翻訳で置き換えるセグメントのバイト範囲を返す（末尾の空白は含まない）
+func (b *nodeBuilder) segmentsSpan(segments *text.Segments) (int, int) {
+	if segments == nil || segments.Len() == 0 {
+		return 0, 0
+	}
+	firstSegment := segments.At(0)
+	lastSegment := segments.At(segments.Len() - 1)
+	start, end := firstSegment.Start, lastSegment.Stop
+	for end > start && isSpace(b.source[end-1]) {
+		end--
+	}
+	for start < end && isSpace(b.source[start]) {
+		start++
+	}
+	return start, end
+}
+
+// first行目からlast行目までの前後の空白を除いたバイト範囲を返す
+func (b *nodeBuilder) trimmedSpan(first, last int) (int, int) {
+	start, end := b.lines[first].start, b.lines[last].end
+	for end > start && isSpace(b.source[end-1]) {
+		end--
+	}
+	for start < end && isSpace(b.source[start]) {
+		start++
+	}
+	return start, end
+}
+
+func (b *nodeBuilder) segmentsText(segments *text.Segments) string {
+	var text strings.Builder
+	for i := 0; i < segments.Len(); i++ {
+		segment := segments.At(i)
+		line := strings.TrimRight(string(segment.Value(b.source)), "\r\n")
+		trimmed := strings.TrimSpace(line)
+		text.WriteString(trimmed)
+		if i == segments.Len()-1 {
+			break
+		}
+
+		// 行末の2つ以上の空白とバックスラッシュによる改行は残す
+		switch {
+		case strings.HasSuffix(line, "  ") && trimmed != "":
+			text.WriteString("  \n")
+		case strings.HasSuffix(trimmed, "\\"):
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+	}
+	return text.String()
+}
+
+func isTextBlock(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		return true
+	}
+	return false
+}
+
+// 画像1つだけからなるパラグラフかどうか
+func isImageOnly(n ast.Node, source []byte) bool {
+	images := 0
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Image:
+			images++
+		case *ast.Text:
+			if strings.TrimSpace(string(c.Segment.Value(source))) != "" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return images == 1
+}
+
+// 開始のフェンスと同じ文字で同じ長さ以上のフェンスだけの行かどうか
+func isClosingFence(line string, fence string) bool {
+	if fence == "" {
+		return false
+	}
+	trimmed := strings.TrimSpace(strings.TrimLeft(line, " >"))
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// コードフェンスの開始行からフェンス文字列（```や~~~）を取り出す
+func codeFence(line string) string {
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		if ch != '`' && ch != '~' {
+			continue
+		}
+		j := i
+		for j < len(line) && line[j] == ch {
+			j++
+		}
+		if j-i >= 3 {
+			return line[i:j]
+		}
+		i = j
+	}
+	return ""
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
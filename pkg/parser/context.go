@@ -0,0 +1,34 @@
+package parser
+
+// Nodeを含む見出しの階層（上の階層から順に並べた見出しのNode。見出し自身は含まない）
+func (n *Node) HeadingPath() []*Node {
+	return n.headings
+}
+
+// 文書のタイトル（フロントマターのtitle、なければ最初のレベル1の見出し）
+func DocumentTitle(nodes []*Node) string {
+	for _, node := range nodes {
+		if node.Type == FrontMatterValue && node.FrontMatterKey == "title" {
+			return node.Text
+		}
+	}
+	for _, node := range nodes {
+		if node.Type == Heading && node.HeadingLevel == 1 {
+			return node.Text
+		}
+	}
+	return ""
+}
+
+// nodes[i]より前にある文章のNodeを近いものからn個まで探し、文書の順に並べて返す
+// （表のセルやフロントマターの値などの断片は文章の流れを表さないので含めない）
+func PreviousPassages(nodes []*Node, i, n int) []*Node {
+	var passages []*Node
+	for j := i - 1; j >= 0 && len(passages) < n; j-- {
+		switch nodes[j].Type {
+		case Paragraph, Item, OrderedItem, DefinitionDescription:
+			passages = append([]*Node{nodes[j]}, passages...)
+		}
+	}
+	return passages
+}
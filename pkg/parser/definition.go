@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// *[HTML]: Hyper Text Markup Language（PHP Markdown Extraの略語の定義）
+var abbreviationPattern = regexp.MustCompile(`^ {0,3}\*\[([^\]]+)\]:[ \t]*`)
+
+// 定義リスト（用語の行と : で始まる説明）
+func (b *nodeBuilder) walkDefinitionList(n *east.DefinitionList) {
+	b.flush(b.firstNonBlankLine())
+
+	list := b.openContainer(Node{Type: DefinitionList})
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *east.DefinitionTerm:
+			first, last, ok := b.segmentsRange(c.Lines())
+			if !ok {
+				continue
+			}
+			textStart, textEnd := b.segmentsSpan(c.Lines())
+			b.emit(Node{
+				Type:           DefinitionTerm,
+				Text:           b.segmentsText(c.Lines()),
+				NestSpaceCount: b.nestSpaceCount(first),
+				TextStart:      textStart,
+				TextEnd:        textEnd,
+			}, first, last)
+		case *east.DefinitionDescription:
+			b.walkDefinitionDescription(c)
+		}
+	}
+	b.closeContainer(list)
+}
+
+// 説明の最初のパラグラフをDefinitionDescriptionのテキストにする（続くブロックは子要素）
+func (b *nodeBuilder) walkDefinitionDescription(n *east.DefinitionDescription) {
+	first := n.FirstChild()
+	start, last, ok := 0, 0, false
+	if first != nil && isTextBlock(first) {
+		start, last, ok = b.segmentsRange(first.Lines())
+	}
+	if !ok {
+		container := b.openContainer(Node{Type: DefinitionDescription})
+		b.walkChildren(n)
+		b.closeContainer(container)
+		return
+	}
+
+	textStart, textEnd := b.segmentsSpan(first.Lines())
+	parent := b.parent
+	if description := b.emit(Node{
+		Type:           DefinitionDescription,
+		Text:           b.segmentsText(first.Lines()),
+		NestSpaceCount: b.nestSpaceCount(start),
+		TextStart:      textStart,
+		TextEnd:        textEnd,
+	}, start, last); description != nil {
+		b.parent = description
+	}
+	for c := first.NextSibling(); c != nil; c = c.NextSibling() {
+		b.walk(c)
+	}
+	b.parent = parent
+}
+
+var kindAbbreviationBlock = ast.NewNodeKind("AbbreviationBlock")
+
+// 略語の定義の行を表すgoldmarkのブロック
+type abbreviationBlock struct {
+	ast.BaseBlock
+	label      string
+	line       text.Segment
+	definition text.Segment
+}
+
+func (n *abbreviationBlock) Kind() ast.NodeKind {
+	return kindAbbreviationBlock
+}
+
+func (n *abbreviationBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Label": n.label}, nil)
+}
+
+type abbreviationParser struct {
+}
+
+func (p *abbreviationParser) Trigger() []byte {
+	return []byte{'*'}
+}
+
+func (p *abbreviationParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	m := abbreviationPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, gparser.NoChildren
+	}
+
+	node := &abbreviationBlock{label: string(line[m[2]:m[3]]), line: segment}
+	definition := util.TrimRightSpace(line[m[1]:])
+	start := segment.Start + m[1] - segment.Padding
+	node.definition = text.NewSegment(start, start+len(definition))
+	advanceLine(reader, line, segment)
+	return node, gparser.NoChildren
+}
+
+func (p *abbreviationParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	return gparser.Close
+}
+
+func (p *abbreviationParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *abbreviationParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *abbreviationParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func abbreviationParsers() []util.PrioritizedValue {
+	return []util.PrioritizedValue{
+		util.Prioritized(&abbreviationParser{}, 750),
+	}
+}
+
+// 略語は翻訳せず、意味の部分だけを翻訳する
+func (b *nodeBuilder) walkAbbreviation(n *abbreviationBlock) {
+	line := b.lineOf(n.line.Start)
+	b.emit(Node{
+		Type:           Abbreviation,
+		Text:           strings.TrimSpace(string(n.definition.Value(b.source))),
+		Label:          n.label,
+		NestSpaceCount: b.nestSpaceCount(line),
+		TextStart:      n.definition.Start,
+		TextEnd:        n.definition.Stop,
+	}, line, line)
+}
@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/text"
+)
+
+var (
+	mermaidStartPattern  = regexp.MustCompile(`^(?:graph|flowchart|sequenceDiagram|classDiagram|stateDiagram(?:-v2)?|erDiagram|gantt|pie|journey|gitGraph|mindmap|timeline|quadrantChart|requirementDiagram)\b`)
+	mermaidFlowchart     = regexp.MustCompile(`^(?:graph|flowchart)\b`)
+	mermaidSequence      = regexp.MustCompile(`^sequenceDiagram\b`)
+	mermaidSkipLine      = regexp.MustCompile(`^(?:%%|classDef\b|class\b|style\b|linkStyle\b|click\b|direction\b|end\b|graph\b|flowchart\b|sequenceDiagram\b|autonumber\b|activate\b|deactivate\b|rect\b)`)
+	mermaidShapePattern  = regexp.MustCompile(`[A-Za-z0-9_]+(\[\[|\[\(|\(\(|\(\[|\{\{|\[/|\[\\|\[|\(|\{|>)`)
+	mermaidEdgePattern   = regexp.MustCompile(`\|([^|]+)\|`)
+	mermaidEdgeText      = regexp.MustCompile(`(?:--|==)\s+([^-=>|\s][^-=>|]*?)\s+(?:-->|---|==>|===)`)
+	sequenceAlias        = regexp.MustCompile(`^(?:participant|actor)\s+\S+\s+as\s+(.+)$`)
+	sequenceMessage      = regexp.MustCompile(`^[^:]*?(?:-->>|->>|-->|->|--x|-x|--\)|-\))[^:]*:\s*(.+)$`)
+	sequenceNote         = regexp.MustCompile(`^[Nn]ote\s+(?:left of|right of|over)\s+[^:]+:\s*(.+)$`)
+	sequenceBlock        = regexp.MustCompile(`^(?:loop|alt|else|opt|par|and|critical|break)\s+(.+)$`)
+	mermaidShapeClosers  = map[string]string{"[[": "]]", "[(": ")]", "((": "))", "([": "])", "{{": "}}", "[/": "/]", "[\\": "\\]", "[": "]", "(": ")", "{": "}", ">": "]"}
+	plantUMLStartPattern = regexp.MustCompile(`^@start[a-z]+`)
+)
+
+// コードブロックが図（Mermaid・PlantUML）なら種類を返す
+func diagramKind(lang, code string) string {
+	switch strings.ToLower(lang) {
+	case "mermaid":
+		return "mermaid"
+	case "plantuml", "puml", "uml":
+		return "plantuml"
+	}
+	if lang != "" {
+		return ""
+	}
+
+	first := strings.TrimSpace(code)
+	if i := strings.IndexByte(first, '\n'); i >= 0 {
+		first = first[:i]
+	}
+	switch {
+	case plantUMLStartPattern.MatchString(first):
+		return "plantuml"
+	case mermaidStartPattern.MatchString(first):
+		return "mermaid"
+	}
+	return ""
+}
+
+// Mermaidのフローチャートとシーケンス図のラベルだけをDiagramLabelの子にする（IDや構文は翻訳しない）
+func (b *nodeBuilder) mermaidLabels(node *Node, lines *text.Segments) {
+	kind := ""
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		line := strings.TrimRight(string(segment.Value(b.source)), "\r\n")
+		trimmed := strings.TrimSpace(line)
+		offset := segment.Start + len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if kind == "" {
+			switch {
+			case trimmed == "" || strings.HasPrefix(trimmed, "%%"):
+				continue
+			case mermaidFlowchart.MatchString(trimmed):
+				kind = "flowchart"
+			case mermaidSequence.MatchString(trimmed):
+				kind = "sequence"
+			default:
+				return
+			}
+			continue
+		}
+
+		var spans [][2]int
+		switch kind {
+		case "flowchart":
+			spans = flowchartLabels(trimmed)
+		case "sequence":
+			spans = sequenceLabels(trimmed)
+		}
+		for _, span := range spans {
+			start, end := offset+span[0], offset+span[1]
+			label := string(b.source[start:end])
+			escape := escapeMermaidText
+			if kind == "flowchart" && !strings.HasPrefix(label, `"`) {
+				escape = escapeMermaidShape
+			}
+			if unquoted := strings.Trim(label, `"`); unquoted != label {
+				label = unquoted
+				start++
+				end--
+				escape = escapeMermaidText
+			}
+			node.Children = append(node.Children, &Node{
+				Index:     b.lineOf(start),
+				Type:      DiagramLabel,
+				Text:      label,
+				Start:     start,
+				End:       end,
+				TextStart: start,
+				TextEnd:   end,
+				Raw:       label,
+				parent:    node,
+				fragment:  true,
+				escape:    escape,
+			})
+		}
+	}
+}
+
+// A[ラベル] や A -->|ラベル| B のラベルの範囲
+func flowchartLabels(line string) [][2]int {
+	if mermaidSkipLine.MatchString(line) {
+		if !strings.HasPrefix(line, "subgraph") {
+			return nil
+		}
+	}
+
+	var spans [][2]int
+	pos := 0
+	for pos < len(line) {
+		m := mermaidShapePattern.FindStringSubmatchIndex(line[pos:])
+		if m == nil {
+			break
+		}
+		opener := line[pos+m[2] : pos+m[3]]
+		start := pos + m[3]
+		end := strings.Index(line[start:], mermaidShapeClosers[opener])
+		if end < 0 {
+			break
+		}
+		if label := strings.TrimSpace(line[start : start+end]); label != "" {
+			i := strings.Index(line[start:], label)
+			spans = append(spans, [2]int{start + i, start + i + len(label)})
+		}
+		pos = start + end + len(mermaidShapeClosers[opener])
+	}
+
+	for _, m := range mermaidEdgePattern.FindAllStringSubmatchIndex(line, -1) {
+		if label := strings.TrimSpace(line[m[2]:m[3]]); label != "" && !overlaps(spans, m[2]) {
+			i := strings.Index(line[m[2]:], label)
+			spans = append(spans, [2]int{m[2] + i, m[2] + i + len(label)})
+		}
+	}
+	for _, m := range mermaidEdgeText.FindAllStringSubmatchIndex(line, -1) {
+		if !overlaps(spans, m[2]) {
+			spans = append(spans, [2]int{m[2], m[3]})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	return spans
+}
+
+// メッセージ・ノート・エイリアス・ブロックのラベルの範囲
+func sequenceLabels(line string) [][2]int {
+	for _, pattern := range []*regexp.Regexp{sequenceAlias, sequenceNote, sequenceBlock, sequenceMessage} {
+		if m := pattern.FindStringSubmatchIndex(line); m != nil {
+			return [][2]int{{m[2], m[3]}}
+		}
+	}
+	return nil
+}
+
+func overlaps(spans [][2]int, pos int) bool {
+	for _, span := range spans {
+		if span[0] <= pos && pos < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Mermaidのテキストに書けない文字をエンティティにする
+func escapeMermaidText(s string) string {
+	replacer := strings.NewReplacer("\n", "<br>", `"`, "#quot;", ";", "#59;")
+	return replacer.Replace(s)
+}
+
+// 括弧を含むラベルはクォートで囲む
+func escapeMermaidShape(s string) string {
+	s = escapeMermaidText(s)
+	if strings.ContainsAny(s, "[](){}|<>") {
+		return `"` + s + `"`
+	}
+	return s
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// 独自のブロックを翻訳するかどうか
+type BlockPolicy int
+
+const (
+	SkipBlock      BlockPolicy = iota // 翻訳しない（Node.NoTranslateがtrueになる）
+	TranslateBlock                    // 開始行と終了行の間（終了行がなければ開始行）を1つのテキストとして翻訳する
+)
+
+// パーサーに追加する独自のブロック（{% include %} のようなテンプレートのタグなど）
+type BlockExtension struct {
+	Name   string         // Node.BlockNameに入る名前
+	Start  *regexp.Regexp // ブロックの開始行
+	End    *regexp.Regexp // ブロックの終了行（nilなら開始行だけのブロック）
+	Policy BlockPolicy
+}
+
+// 名前と開始行のパターンがあり、名前が重複していないことを確かめる
+func validateBlockExtensions(extensions []BlockExtension) error {
+	names := map[string]bool{}
+	for _, extension := range extensions {
+		if extension.Name == "" || extension.Start == nil {
+			return fmt.Errorf("block extension needs a name and a start pattern")
+		}
+		if names[extension.Name] {
+			return fmt.Errorf("block extension %q is specified more than once", extension.Name)
+		}
+		names[extension.Name] = true
+	}
+	return nil
+}
+
+func customBlockParsers(extensions []BlockExtension) []util.PrioritizedValue {
+	var parsers []util.PrioritizedValue
+	for _, extension := range extensions {
+		parsers = append(parsers, util.Prioritized(&customBlockParser{extension: extension}, 740))
+	}
+	return parsers
+}
+
+var kindCustomBlock = ast.NewNodeKind("CustomBlock")
+
+// 登録された独自のブロックを表すgoldmarkのブロック
+type customBlock struct {
+	ast.BaseBlock
+	extension BlockExtension
+	opener    text.Segment
+	last      text.Segment
+	closed    bool
+}
+
+func (n *customBlock) Kind() ast.NodeKind {
+	return kindCustomBlock
+}
+
+func (n *customBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.extension.Name}, nil)
+}
+
+type customBlockParser struct {
+	extension BlockExtension
+}
+
+// どの文字で始まる行でも試す
+func (p *customBlockParser) Trigger() []byte {
+	return nil
+}
+
+func (p *customBlockParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	content := strings.TrimRight(string(line), "\r\n")
+	m := p.extension.Start.FindStringIndex(content)
+	if m == nil {
+		return nil, gparser.NoChildren
+	}
+
+	node := &customBlock{extension: p.extension, opener: segment, last: segment}
+	// 終了行のないブロックと、開始行で閉じるブロック
+	node.closed = p.extension.End == nil || p.extension.End.MatchString(content[m[1]:])
+	advanceLine(reader, line, segment)
+	return node, gparser.NoChildren
+}
+
+func (p *customBlockParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	block := node.(*customBlock)
+	if block.closed {
+		return gparser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	block.last = segment
+	if block.extension.End.MatchString(strings.TrimRight(string(line), "\r\n")) {
+		block.closed = true
+	}
+	advanceLine(reader, line, segment)
+	if block.closed {
+		return gparser.Close
+	}
+	return gparser.Continue | gparser.NoChildren
+}
+
+func (p *customBlockParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *customBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *customBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func (b *nodeBuilder) walkCustomBlock(n *customBlock) {
+	first := b.lineOf(n.opener.Start)
+	last := b.lineOf(n.last.Start)
+	if !n.closed {
+		b.diagnose(n.opener.Start, "%s block is not closed", n.extension.Name)
+	}
+
+	node := Node{
+		Type:           CustomBlock,
+		BlockName:      n.extension.Name,
+		NestSpaceCount: b.nestSpaceCount(first),
+		NoTranslate:    n.extension.Policy == SkipBlock,
+		TextStart:      b.lines[first].end,
+		TextEnd:        b.lines[first].end,
+	}
+
+	var texts []string
+	for i := first; i <= last; i++ {
+		texts = append(texts, b.lineText(i))
+	}
+	node.Text = strings.Join(texts, "\n")
+
+	if n.extension.Policy == TranslateBlock {
+		// 終了行があれば開始行と終了行の間を翻訳する
+		textFirst, textLast := first, last
+		if n.extension.End != nil {
+			textFirst, textLast = first+1, last-1
+		}
+		if textFirst <= textLast {
+			node.TextStart, node.TextEnd = b.trimmedSpan(textFirst, textLast)
+			node.Text = strings.TrimSpace(strings.Join(texts[textFirst-first:textLast-first+1], "\n"))
+		} else {
+			node.Text = ""
+		}
+	}
+	b.emit(node, first, last)
+}
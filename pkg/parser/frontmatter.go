@@ -0,0 +1,294 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+type FrontMatterFormat int
+
+const (
+	NoFrontMatter   FrontMatterFormat = iota
+	YAMLFrontMatter                   // --- で囲まれたYAML
+	TOMLFrontMatter                   // +++ で囲まれたTOML
+)
+
+// Options.FrontMatterKeysを指定しなかったときに翻訳するフロントマターのキー
+var DefaultFrontMatterKeys = []string{"title", "description", "summary"}
+
+var (
+	yamlKeyPattern   = regexp.MustCompile(`^([A-Za-z0-9_-]+)[ \t]*:(?:[ \t]+|$)`)
+	tomlKeyPattern   = regexp.MustCompile(`^([A-Za-z0-9_-]+)[ \t]*=[ \t]*`)
+	tomlTablePattern = regexp.MustCompile(`^\s*\[`)
+	blockScalarStart = regexp.MustCompile(`^[|>][+-]?[0-9]?[+-]?[ \t]*(?:#.*)?$`)
+)
+
+// ドキュメント先頭のフロントマターの形式と閉じる区切りの行のインデックスを返す
+func findFrontMatter(b *nodeBuilder) (FrontMatterFormat, int) {
+	if len(b.lines) < 2 {
+		return NoFrontMatter, 0
+	}
+
+	first := strings.TrimRight(strings.TrimPrefix(b.lineText(0), "\ufeff"), " \t\r")
+	var format FrontMatterFormat
+	var closers []string
+	switch first {
+	case "---":
+		format, closers = YAMLFrontMatter, []string{"---", "..."}
+	case "+++":
+		format, closers = TOMLFrontMatter, []string{"+++"}
+	default:
+		return NoFrontMatter, 0
+	}
+
+	for i := 1; i < len(b.lines); i++ {
+		line := strings.TrimRight(b.lineText(i), " \t\r")
+		for _, closer := range closers {
+			if line == closer {
+				return format, i
+			}
+		}
+	}
+	return NoFrontMatter, 0
+}
+
+// フロントマターをFrontMatterとして追加し、翻訳するキーの値をFrontMatterValueの子にする
+func (b *nodeBuilder) emitFrontMatter(format FrontMatterFormat, last int) {
+	node := b.emit(Node{
+		Type:              FrontMatter,
+		Text:              string(b.source[b.lines[0].start:b.lines[last].end]),
+		FrontMatterFormat: format,
+		TextStart:         b.lines[0].end,
+		TextEnd:           b.lines[0].end,
+	}, 0, last)
+	if node == nil {
+		return
+	}
+
+	keys := b.opts.FrontMatterKeys
+	if keys == nil {
+		keys = DefaultFrontMatterKeys
+	}
+	targets := map[string]bool{}
+	for _, key := range keys {
+		targets[key] = true
+	}
+
+	for i := 1; i < last; i++ {
+		var value *Node
+		var next int
+		switch format {
+		case YAMLFrontMatter:
+			value, next = b.yamlValue(i, last, targets)
+		case TOMLFrontMatter:
+			if tomlTablePattern.MatchString(b.lineText(i)) {
+				// テーブルより後ろはトップレベルのキーではない
+				i = last
+				continue
+			}
+			value, next = b.tomlValue(i, last, targets)
+		}
+		if value != nil {
+			value.parent = node
+			node.Children = append(node.Children, value)
+		}
+		if next > i {
+			i = next
+		}
+	}
+}
+
+// i行目がトップレベルの翻訳するキーなら値をFrontMatterValueとして返す（値の最後の行も返す）
+func (b *nodeBuilder) yamlValue(i, last int, targets map[string]bool) (*Node, int) {
+	line := b.lineText(i)
+	m := yamlKeyPattern.FindStringSubmatchIndex(line)
+	if m == nil || !targets[line[m[2]:m[3]]] {
+		return nil, i
+	}
+	key := line[m[2]:m[3]]
+	lineStart := b.lines[i].start
+	rest := strings.TrimRight(line[m[1]:], " \t\r")
+	restStart := lineStart + m[1]
+
+	switch {
+	case rest == "":
+		return nil, i
+	case rest[0] == '"':
+		end := closingQuote(rest, '"', '\\')
+		if end < 0 {
+			return nil, i
+		}
+		text := unescapeDoubleQuoted(rest[1:end])
+		return b.frontMatterValue(key, text, i, restStart, restStart+end+1, quoteDoubleQuoted), i
+	case rest[0] == '\'':
+		end := closingQuote(rest, '\'', 0)
+		if end < 0 {
+			return nil, i
+		}
+		text := strings.ReplaceAll(rest[1:end], "''", "'")
+		return b.frontMatterValue(key, text, i, restStart, restStart+end+1, quoteYAMLSingleQuoted), i
+	case blockScalarStart.MatchString(rest):
+		return b.yamlBlockScalar(key, rest[0], i, last)
+	case strings.ContainsAny(rest[:1], "[{&*!#@`%|>"):
+		return nil, i
+	}
+
+	// クォートされていないスカラー（行末のコメントは含めない）
+	if j := strings.Index(rest, " #"); j >= 0 {
+		rest = strings.TrimRight(rest[:j], " \t")
+	}
+	return b.frontMatterValue(key, rest, i, restStart, restStart+len(rest), quoteYAMLPlain), i
+}
+
+// | や > のブロックスカラー
+func (b *nodeBuilder) yamlBlockScalar(key string, style byte, i, last int) (*Node, int) {
+	first, end := -1, i
+	indent := ""
+	var lines []string
+	for j := i + 1; j < last; j++ {
+		line := b.lineText(j)
+		if strings.TrimSpace(line) == "" {
+			if first >= 0 {
+				lines = append(lines, "")
+			}
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		if lineIndent == "" {
+			break
+		}
+		if first < 0 {
+			first, indent = j, lineIndent
+		}
+		lines = append(lines, strings.TrimRight(strings.TrimPrefix(line, indent), " \t\r"))
+		end = j
+	}
+	if first < 0 {
+		return nil, i
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	text := strings.Join(lines, "\n")
+	if style == '>' {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+
+	start := b.lines[first].start + len(indent)
+	stop := b.lines[end].end
+	for stop > start && isSpace(b.source[stop-1]) {
+		stop--
+	}
+	reindent := func(s string) string {
+		return strings.ReplaceAll(s, "\n", "\n"+indent)
+	}
+	return b.frontMatterValue(key, text, first, start, stop, reindent), end
+}
+
+func (b *nodeBuilder) tomlValue(i, last int, targets map[string]bool) (*Node, int) {
+	line := b.lineText(i)
+	m := tomlKeyPattern.FindStringSubmatchIndex(line)
+	if m == nil || !targets[line[m[2]:m[3]]] {
+		return nil, i
+	}
+	key := line[m[2]:m[3]]
+	rest := strings.TrimRight(line[m[1]:], " \t\r")
+	restStart := b.lines[i].start + m[1]
+
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		// 複数行の基本文字列
+		start := restStart
+		end := strings.Index(string(b.source[start+3:b.lines[last].start]), `"""`)
+		if end < 0 {
+			return nil, i
+		}
+		stop := start + 3 + end + 3
+		text := strings.TrimPrefix(string(b.source[start+3:stop-3]), "\n")
+		return b.frontMatterValue(key, unescapeDoubleQuoted(text), i, start, stop, quoteTOMLMultiline), b.lineOf(stop - 1)
+	case strings.HasPrefix(rest, `"`):
+		end := closingQuote(rest, '"', '\\')
+		if end < 0 {
+			return nil, i
+		}
+		return b.frontMatterValue(key, unescapeDoubleQuoted(rest[1:end]), i, restStart, restStart+end+1, quoteDoubleQuoted), i
+	case strings.HasPrefix(rest, `'`) && !strings.HasPrefix(rest, `'''`):
+		end := closingQuote(rest, '\'', 0)
+		if end < 0 {
+			return nil, i
+		}
+		return b.frontMatterValue(key, rest[1:end], i, restStart, restStart+end+1, quoteTOMLLiteral), i
+	}
+	return nil, i
+}
+
+func (b *nodeBuilder) frontMatterValue(key, text string, line, start, end int, escape func(string) string) *Node {
+	return &Node{
+		Index:          line,
+		Type:           FrontMatterValue,
+		Text:           text,
+		FrontMatterKey: key,
+		Start:          start,
+		End:            end,
+		TextStart:      start,
+		TextEnd:        end,
+		Raw:            string(b.source[start:end]),
+		fragment:       true,
+		escape:         escape,
+	}
+}
+
+// 開始のクォートに対応する閉じるクォートの位置を返す
+func closingQuote(s string, quote byte, escape byte) int {
+	for i := 1; i < len(s); i++ {
+		if escape != 0 && s[i] == escape {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			if escape == 0 && i+1 < len(s) && s[i+1] == quote {
+				// YAMLのシングルクォート内の '' はエスケープ
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(s string) string {
+	replacer := strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\t`, "\t")
+	return replacer.Replace(s)
+}
+
+func quoteDoubleQuoted(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + replacer.Replace(s) + `"`
+}
+
+func quoteYAMLSingleQuoted(s string) string {
+	return `'` + strings.ReplaceAll(strings.ReplaceAll(s, "\n", " "), "'", "''") + `'`
+}
+
+// クォートしなくても値が壊れない場合だけそのまま出力する
+func quoteYAMLPlain(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.ContainsAny(s, "\n\t") || strings.HasSuffix(s, ":") {
+		return quoteDoubleQuoted(s)
+	}
+	return s
+}
+
+func quoteTOMLLiteral(s string) string {
+	if strings.ContainsAny(s, "'\n") {
+		return quoteDoubleQuoted(s)
+	}
+	return `'` + s + `'`
+}
+
+func quoteTOMLMultiline(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"""`, `\"\"\"`)
+	return `"""` + "\n" + replacer.Replace(s) + `"""`
+}
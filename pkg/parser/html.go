@@ -0,0 +1,203 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// 中身を翻訳しないHTML要素（translate="no" などの属性を持つ要素も翻訳しない）
+var untranslatableHTMLElements = map[string]bool{
+	"script": true,
+	"style":  true,
+	"pre":    true,
+	"code":   true,
+	"kbd":    true,
+	"samp":   true,
+}
+
+// 終了タグのない要素
+var voidHTMLElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// translate="no" または class="notranslate" の属性を持つかどうか
+func hasNoTranslateAttr(tokenizer *html.Tokenizer) bool {
+	for {
+		key, value, more := tokenizer.TagAttr()
+		switch string(key) {
+		case "translate":
+			if strings.EqualFold(string(value), "no") {
+				return true
+			}
+		case "class":
+			for _, class := range strings.Fields(string(value)) {
+				if class == "notranslate" {
+					return true
+				}
+			}
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// 文章の途中に書けるインライン要素（テキストと一緒に1つのHTMLTextにする）
+// <kbd> の中身はProtectInlineで守られないので、前後でHTMLTextを分ける
+var inlineHTMLElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "br": true, "cite": true, "code": true,
+	"data": true, "del": true, "dfn": true, "em": true, "i": true, "img": true, "ins": true,
+	"mark": true, "q": true, "s": true, "samp": true, "small": true, "span": true, "strong": true,
+	"sub": true, "sup": true, "time": true, "u": true, "var": true, "wbr": true,
+}
+
+// 文字参照（&amp; &#39; &#x27;）
+var htmlEntityPattern = regexp.MustCompile(`^&(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#[xX][0-9A-Fa-f]+);`)
+
+// HTMLブロックのタグと属性を除いたテキストの部分をHTMLTextとして返す
+// インライン要素で区切られたテキストはタグごと1つのHTMLTextにする（タグはProtectInlineでプレースホルダーになる）
+func htmlTextFragments(node *Node) []*Node {
+	var fragments []*Node
+
+	tokenizer := html.NewTokenizer(strings.NewReader(node.Raw))
+	offset := 0
+	var skipping []string // 翻訳しない要素とその中で開いている要素の名前
+
+	// 1つのHTMLTextにするテキストとインライン要素の並び
+	runStart, runEnd := -1, -1 // 最初と最後のテキストの位置（インライン要素のタグを含む）
+	pending := -1              // テキストより前に現れたインライン要素の開始位置
+	var tags []string          // 並びの中のタグ（訳に含まれていればエスケープしない）
+	flush := func() {
+		if runStart >= 0 {
+			fragments = append(fragments, htmlTextFragment(node, runStart, runEnd, tags))
+		}
+		runStart, runEnd, pending = -1, -1, -1
+		tags = nil
+	}
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		raw := string(tokenizer.Raw())
+		start := offset
+		offset += len(raw)
+
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			if len(skipping) == 0 && !inlineHTMLElements[string(name)] {
+				flush()
+			}
+			if tokenType == html.StartTagToken && !voidHTMLElements[string(name)] {
+				if len(skipping) > 0 || untranslatableHTMLElements[string(name)] || (hasAttr && hasNoTranslateAttr(tokenizer)) {
+					skipping = append(skipping, string(name))
+				}
+			}
+			if inlineHTMLElements[string(name)] && runStart < 0 && pending < 0 {
+				pending = start
+			}
+			tags = append(tags, raw)
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			for i := len(skipping) - 1; i >= 0; i-- {
+				if skipping[i] == string(name) {
+					skipping = skipping[:i]
+					break
+				}
+			}
+			if len(skipping) > 0 {
+				continue
+			}
+			if !inlineHTMLElements[string(name)] {
+				flush()
+				continue
+			}
+			// 並びの中で開いたインライン要素は閉じタグまで含める
+			if runStart >= 0 {
+				runEnd = offset
+			}
+			tags = append(tags, raw)
+		case html.CommentToken:
+			tags = append(tags, raw)
+		case html.TextToken:
+			text := strings.TrimSpace(raw)
+			if len(skipping) > 0 || text == "" {
+				continue
+			}
+
+			textStart := start + strings.Index(raw, text)
+			if runStart < 0 {
+				runStart = textStart
+				if pending >= 0 {
+					runStart = pending
+				}
+			}
+			runEnd = textStart + len(text)
+		}
+	}
+	flush()
+
+	return fragments
+}
+
+// Rawのstartからendまでを翻訳するHTMLTextを作る
+func htmlTextFragment(node *Node, start, end int, tags []string) *Node {
+	raw := node.Raw[start:end]
+	return &Node{
+		Index:     node.Index + strings.Count(node.Raw[:start], "\n"),
+		Type:      HTMLText,
+		Text:      strings.Join(strings.Fields(raw), " "),
+		Start:     node.Start + start,
+		End:       node.Start + end,
+		TextStart: node.Start + start,
+		TextEnd:   node.Start + end,
+		Raw:       raw,
+		fragment:  true,
+		escape:    escapeHTMLText(tags),
+	}
+}
+
+// 訳の < > & をエスケープする（元のテキストにあったタグと文字参照はそのまま残す）
+func escapeHTMLText(tags []string) func(string) string {
+	return func(s string) string {
+		var escaped strings.Builder
+		for i := 0; i < len(s); {
+			switch s[i] {
+			case '<':
+				if tag := prefixTag(s[i:], tags); tag != "" {
+					escaped.WriteString(tag)
+					i += len(tag)
+					continue
+				}
+				escaped.WriteString("&lt;")
+			case '>':
+				escaped.WriteString("&gt;")
+			case '&':
+				if htmlEntityPattern.MatchString(s[i:]) {
+					escaped.WriteByte('&')
+				} else {
+					escaped.WriteString("&amp;")
+				}
+			default:
+				escaped.WriteByte(s[i])
+			}
+			i++
+		}
+		return escaped.String()
+	}
+}
+
+func prefixTag(s string, tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(s, tag) {
+			return tag
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+var quoteReplacer = strings.NewReplacer(
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+	"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`,
+)
+
+// キャッシュのキーにするためにテキストを正規化する
+// （空白をまとめ、ソフト改行を空白にし、Unicodeの引用符をASCIIにする。ハード改行は残す）
+func NormalizeText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var normalized strings.Builder
+	hardBreak := false
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if normalized.Len() > 0 {
+			if hardBreak {
+				normalized.WriteString("\n")
+			} else {
+				normalized.WriteString(" ")
+			}
+		}
+		normalized.WriteString(strings.Join(fields, " "))
+		hardBreak = strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+	}
+	return quoteReplacer.Replace(normalized.String())
+}
+
+// 祖先の見出し・種類・正規化したテキストから各NodeのIDを作る
+// 同じ見出しの下にある同じ種類・同じテキストのNodeは同じIDになる（祖先の見出しはHeadingPathで返す）
+func assignIDs(nodes []*Node) {
+	var headings []*Node // 現在の見出しの階層
+	for _, node := range nodes {
+		if node.Type == Heading {
+			for len(headings) > 0 && headings[len(headings)-1].HeadingLevel >= node.HeadingLevel {
+				headings = headings[:len(headings)-1]
+			}
+		}
+
+		var path []string
+		for _, heading := range headings {
+			path = append(path, NormalizeText(heading.Text))
+		}
+		node.ID = nodeID(node.Type, path, node.Text)
+		node.headings = append([]*Node(nil), headings...)
+
+		if node.Type == Heading {
+			headings = append(headings, node)
+		}
+	}
+}
+
+func nodeID(nodeType NodeType, path []string, text string) string {
+	hash := sha256.New()
+	hash.Write([]byte(nodeType.String()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(path, "\x1f")))
+	hash.Write([]byte{0})
+	hash.Write([]byte(NormalizeText(text)))
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
@@ -0,0 +1,336 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`⟦(\d+)⟧`)
+	autolinkPattern    = regexp.MustCompile(`^<(?:[A-Za-z][A-Za-z0-9+.-]{1,31}:[^\s<>]*|[A-Za-z0-9.!#$%&'*+/=?^_{|}~-]+@[A-Za-z0-9.-]+)>`)
+	inlineHTMLPattern  = regexp.MustCompile(`^(?:<!--[\s\S]*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][\w.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>)`)
+	bareURLPattern     = regexp.MustCompile(`^(?:https?://|www\.)[^\s<]*[^\s<.,:;!?"')\]]`)
+	noTranslateSpan    = regexp.MustCompile(`^<span\b[^>]*?\s(?:translate\s*=\s*["']?no\b|class\s*=\s*["'][^"']*\bnotranslate\b)[^>]*>`)
+	spanTagPattern     = regexp.MustCompile(`<span\b[^>]*>|</span\s*>`)
+	codeElementPattern = regexp.MustCompile(`^<(code|samp)(?:\s[^>]*)?>`)
+)
+
+// 翻訳しないインライン要素と置き換えたプレースホルダー
+type Placeholder struct {
+	Token    string // ⟦0⟧ のようなプレースホルダー
+	Original string // 置き換える前のマークダウン
+}
+
+// 翻訳しないインライン要素をプレースホルダーに置き換えたテキスト
+type ProtectedText struct {
+	Text         string
+	Placeholders []Placeholder
+}
+
+// インラインコード・数式・URL・リンク先・HTMLタグ・{式}・強調の記号・<span translate="no"> と <code> の中身をプレースホルダーに置き換える
+func ProtectInline(text string) *ProtectedText {
+	protected := &ProtectedText{}
+	var out strings.Builder
+	spanStart := -1 // 置き換え中の範囲の開始位置（隣り合う範囲はまとめる）
+
+	protect := func(start int) {
+		if spanStart < 0 {
+			spanStart = start
+		}
+	}
+	closeSpan := func(end int) {
+		if spanStart < 0 {
+			return
+		}
+		token := "⟦" + strconv.Itoa(len(protected.Placeholders)) + "⟧"
+		protected.Placeholders = append(protected.Placeholders, Placeholder{Token: token, Original: text[spanStart:end]})
+		out.WriteString(token)
+		spanStart = -1
+	}
+
+	// リンクの閉じ括弧の後ろで置き換える範囲の終わり
+	linkTails := map[int]int{}
+
+	for i := 0; i < len(text); {
+		if end, ok := linkTails[i]; ok {
+			protect(i)
+			i = end
+			continue
+		}
+
+		end := inlineTokenEnd(text, i, linkTails)
+		if end > i {
+			protect(i)
+			i = end
+			continue
+		}
+
+		closeSpan(i)
+		_, size := utf8.DecodeRuneInString(text[i:])
+		out.WriteString(text[i : i+size])
+		i += size
+	}
+	closeSpan(len(text))
+
+	protected.Text = out.String()
+	return protected
+}
+
+// i文字目から始まる翻訳しない要素の終わりの位置を返す（要素でなければiを返す）
+func inlineTokenEnd(text string, i int, linkTails map[int]int) int {
+	rest := text[i:]
+	switch text[i] {
+	case ' ':
+		// 行末の2つ以上の空白による改行
+		if n := runLength(text, i, ' '); n >= 2 && i+n < len(text) && text[i+n] == '\n' {
+			return i + n + 1
+		}
+	case '\\':
+		// バックスラッシュでエスケープされた記号と改行
+		if i+1 < len(text) && strings.ContainsRune("\n!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", rune(text[i+1])) {
+			return i + 2
+		}
+	case '`':
+		n := runLength(text, i, '`')
+		for j := i + n; j < len(text); {
+			k := strings.IndexByte(text[j:], '`')
+			if k < 0 {
+				break
+			}
+			j += k
+			m := runLength(text, j, '`')
+			if m == n {
+				return j + m
+			}
+			j += m
+		}
+		return i + n
+	case '<':
+		if loc := autolinkPattern.FindStringIndex(rest); loc != nil {
+			return i + loc[1]
+		}
+		if end := noTranslateSpanEnd(rest); end > 0 {
+			return i + end
+		}
+		if end := untranslatableElementEnd(rest); end > 0 {
+			return i + end
+		}
+		if loc := inlineHTMLPattern.FindStringIndex(rest); loc != nil {
+			return i + loc[1]
+		}
+	case '{':
+		// MDXの {式} やテンプレートの {{ 変数 }}
+		if end := scanJSXExpression([]byte(rest), 0); end > 0 {
+			return i + end
+		}
+	case '!':
+		if strings.HasPrefix(rest, "![") {
+			if tail := linkTail(text, i+1); tail > 0 {
+				linkTails[closingBracket(text, i+1)] = tail
+				return i + 2
+			}
+		}
+	case '[':
+		if strings.HasPrefix(rest, "[^") {
+			// 脚注の参照
+			if j := closingBracket(text, i); j > 0 {
+				return j + 1
+			}
+		}
+		if tail := linkTail(text, i); tail > 0 {
+			linkTails[closingBracket(text, i)] = tail
+			return i + 1
+		}
+	case '*', '_', '~':
+		n := runLength(text, i, text[i])
+		if text[i] == '~' && n < 2 {
+			return i
+		}
+		if isEmphasisDelimiter(text, i, i+n) {
+			return i + n
+		}
+		return i
+	case '$':
+		// インラインの数式（$ の直後と閉じる $ の直前は空白でない）
+		n := runLength(text, i, '$')
+		if n > 2 || i+n >= len(text) || isSpace(text[i+n]) {
+			return i
+		}
+		for j := i + n; j < len(text); j++ {
+			if text[j] == '\\' {
+				j++
+				continue
+			}
+			if text[j] == '\n' && n == 1 {
+				return i
+			}
+			if text[j] == '$' && runLength(text, j, '$') == n && !isSpace(text[j-1]) && text[j-1] != '$' {
+				if end := j + n; end >= len(text) || text[end] < '0' || text[end] > '9' {
+					return end
+				}
+			}
+		}
+		return i
+	case 'h', 'w':
+		if i > 0 && !isSpace(text[i-1]) && !strings.ContainsRune("(<[\"'", rune(text[i-1])) {
+			return i
+		}
+		if loc := bareURLPattern.FindStringIndex(rest); loc != nil {
+			return i + loc[1]
+		}
+	}
+	return i
+}
+
+// <span translate="no"> から対応する </span> までの長さを返す（閉じていなければ0）
+func noTranslateSpanEnd(text string) int {
+	if !noTranslateSpan.MatchString(text) {
+		return 0
+	}
+	depth := 0
+	for _, loc := range spanTagPattern.FindAllStringIndex(text, -1) {
+		if strings.HasPrefix(text[loc[0]:], "</") {
+			depth--
+		} else {
+			depth++
+		}
+		if depth == 0 {
+			return loc[1]
+		}
+	}
+	return 0
+}
+
+// <code> <samp> から閉じタグまでの長さを返す（閉じていなければ0）
+func untranslatableElementEnd(text string) int {
+	m := codeElementPattern.FindStringSubmatch(text)
+	if m == nil {
+		return 0
+	}
+	end := strings.Index(text, "</"+m[1]+">")
+	if end < 0 {
+		return 0
+	}
+	return end + len("</"+m[1]+">")
+}
+
+// [ に対応する ] の位置を返す
+func closingBracket(text string, open int) int {
+	depth := 0
+	for j := open; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '`':
+			j += runLength(text, j, '`') - 1
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// [text](url) や [text][id] の ] から後ろの終わりの位置を返す（リンクでなければ0）
+func linkTail(text string, open int) int {
+	closeBracket := closingBracket(text, open)
+	if closeBracket < 0 || closeBracket+1 >= len(text) {
+		return 0
+	}
+
+	var opener, closer byte
+	switch text[closeBracket+1] {
+	case '(':
+		opener, closer = '(', ')'
+	case '[':
+		opener, closer = '[', ']'
+	default:
+		return 0
+	}
+
+	depth := 0
+	for j := closeBracket + 1; j < len(text); j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case opener:
+			depth++
+		case closer:
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		case '\n':
+			if opener == '[' {
+				return 0
+			}
+		}
+	}
+	return 0
+}
+
+func runLength(text string, i int, ch byte) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == ch {
+		n++
+	}
+	return n
+}
+
+// 強調の記号として働く記号の並びかどうか（CommonMarkのleft-flanking・right-flankingの簡易版）
+func isEmphasisDelimiter(text string, start, end int) bool {
+	before, after := ' ', ' '
+	if start > 0 {
+		before, _ = utf8.DecodeLastRuneInString(text[:start])
+	}
+	if end < len(text) {
+		after, _ = utf8.DecodeRuneInString(text[end:])
+	}
+
+	leftFlanking := !unicode.IsSpace(after) && (!unicode.IsPunct(after) || unicode.IsSpace(before) || unicode.IsPunct(before))
+	rightFlanking := !unicode.IsSpace(before) && (!unicode.IsPunct(before) || unicode.IsSpace(after) || unicode.IsPunct(after))
+
+	if text[start] == '_' && leftFlanking && rightFlanking {
+		// snake_case のような単語内の _ は強調ではない
+		return unicode.IsPunct(before) || unicode.IsPunct(after)
+	}
+	return leftFlanking || rightFlanking
+}
+
+// 翻訳されたテキストのプレースホルダーを元のマークダウンに戻す
+func (p *ProtectedText) Restore(translated string) (string, error) {
+	counts := map[string]int{}
+	for _, match := range placeholderPattern.FindAllString(translated, -1) {
+		counts[match]++
+	}
+
+	for _, placeholder := range p.Placeholders {
+		switch counts[placeholder.Token] {
+		case 0:
+			return "", fmt.Errorf("placeholder %s (%q) is missing in the translation", placeholder.Token, placeholder.Original)
+		case 1:
+		default:
+			return "", fmt.Errorf("placeholder %s (%q) is duplicated in the translation", placeholder.Token, placeholder.Original)
+		}
+		delete(counts, placeholder.Token)
+	}
+	for token := range counts {
+		return "", fmt.Errorf("unknown placeholder %s in the translation", token)
+	}
+
+	originals := map[string]string{}
+	for _, placeholder := range p.Placeholders {
+		originals[placeholder.Token] = placeholder.Original
+	}
+	return placeholderPattern.ReplaceAllStringFunc(translated, func(token string) string {
+		return originals[token]
+	}), nil
+}
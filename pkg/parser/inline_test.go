@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProtectInline(t *testing.T) {
+	source := "Run `go build` on **main.go**, see [the docs](https://go.dev/doc \"Docs\") or https://go.dev. Keep snake_case <kbd>Ctrl</kbd>[^1]"
+	protected := ProtectInline(source)
+
+	expected := "Run ⟦0⟧ on ⟦1⟧main.go⟦2⟧, see ⟦3⟧the docs⟦4⟧ or ⟦5⟧. Keep snake_case ⟦6⟧Ctrl⟦7⟧"
+	if protected.Text != expected {
+		t.Fatalf("unexpected text:\n got: %q\nwant: %q", protected.Text, expected)
+	}
+	if last := protected.Placeholders[7].Original; last != "</kbd>[^1]" {
+		t.Errorf("adjacent spans should share a placeholder, got %q", last)
+	}
+
+	translated := "⟦5⟧ か ⟦3⟧ドキュメント⟦4⟧ を見て、⟦1⟧main.go⟦2⟧ で ⟦0⟧ を実行する。snake_case ⟦6⟧Ctrl⟦7⟧ はそのまま"
+	restored, err := protected.Restore(translated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, placeholder := range protected.Placeholders {
+		if !strings.Contains(restored, placeholder.Original) {
+			t.Errorf("restored text lost %q: %s", placeholder.Original, restored)
+		}
+	}
+}
+
+func TestRestoreReportsBrokenPlaceholders(t *testing.T) {
+	protected := ProtectInline("Use `a` and `b`")
+
+	cases := map[string]string{
+		"missing":    "⟦0⟧ を使う",
+		"duplicated": "⟦0⟧ と ⟦1⟧ と ⟦1⟧ を使う",
+		"unknown":    "⟦0⟧ と ⟦1⟧ と ⟦2⟧ を使う",
+	}
+	for name, translated := range cases {
+		if _, err := protected.Restore(translated); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: expected %s error, got %v", name, name, err)
+		}
+	}
+}
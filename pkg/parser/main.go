@@ -1,14 +1,9 @@
 package parser
 
 import (
-	"fmt"
 	"io/ioutil"
-	"log"
-	"regexp"
-	"strconv"
 	"strings"
 
-	"github.com/cheggaaa/pb"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/parser"
 )
@@ -27,180 +22,178 @@ func IsValidMarkdown(text string) bool {
 type NodeType int
 
 const (
-	Heading     NodeType = iota // 見出し
-	Paragraph                   // パラグラフ
-	Item                        // 箇条書きリストの要素
-	OrderedItem                 // 番号付きリストの要素
-	CodeBlock                   // コードブロック
-	Image                       // 画像
-	Table                       // テーブル
-	Blank                       // 空行
-	Other                       // その他の要素
+	Heading               NodeType = iota // 見出し
+	Paragraph                             // パラグラフ
+	Item                                  // 箇条書きリストの要素
+	OrderedItem                           // 番号付きリストの要素
+	CodeBlock                             // コードブロック
+	Image                                 // 画像
+	Table                                 // テーブル
+	Blank                                 // 空行
+	Other                                 // その他の要素
+	Root                                  // ドキュメント全体（ツリーの根）
+	List                                  // リスト（Item・OrderedItemのコンテナ）
+	IndentedCode                          // インデントされたコードブロック
+	HTMLBlock                             // HTMLブロック
+	HTMLText                              // HTMLブロック内のテキスト（Options.TranslateHTMLTextのときだけ作られる）
+	Blockquote                            // 引用（子要素のコンテナ）
+	Admonition                            // GitHubのアラートやMkDocs・Docusaurusのアドモニションの開始行（本文は子要素）
+	FrontMatter                           // ドキュメント先頭のYAML・TOMLのフロントマター
+	FrontMatterValue                      // フロントマターのうち翻訳するキーの値
+	TableCell                             // テーブルのセル
+	LinkDefinition                        // リンク参照定義（[id]: https://...）
+	Footnote                              // 脚注の定義（[^1]: ...）。最初のパラグラフを本文にする
+	MathBlock                             // $$ で囲まれた数式のブロック
+	DiagramLabel                          // Mermaidの図のラベル（Options.TranslateMermaidLabelsのときだけ作られる）
+	ThematicBreak                         // 水平線（---, ***, ___）
+	ESM                                   // MDXの import / export の行（翻訳しない）
+	JSX                                   // MDXのJSXの要素や {式} だけの行（翻訳しない。中のマークダウンは別のNodeになる）
+	JSXProp                               // JSXの要素の文字列のprops（Options.JSXPropsのものだけ作られる）
+	DefinitionList                        // 定義リスト（子要素だけを持つ）
+	DefinitionTerm                        // 定義リストの用語
+	DefinitionDescription                 // 定義リストの : で始まる説明
+	Abbreviation                          // *[HTML]: の略語の定義（略語は翻訳せず意味だけを翻訳する）
+	CustomBlock                           // Options.BlockExtensionsで追加した独自のブロック
 )
 
-type Node struct {
-	Index          int
-	Type           NodeType // どの種類のNodeか
-	Text           string   // マークダウンのテキスト
-	TranslatedText string
-	OrderedItemNum int
-	NestSpaceCount int // 箇条書きリスト要素のネストのためのスペースが何個あるか
-	HeadingLevel   int // 見出しのレベル
-	CodeLang       string
+type Options struct {
+	TranslateHTMLText      bool          // HTMLブロック内のテキストをHTMLTextとして翻訳の対象にする
+	FrontMatterKeys        []string      // フロントマターで翻訳するキー（nilならDefaultFrontMatterKeys）
+	SkipTableCodeColumns   bool          // コードや識別子だけの列のセルを翻訳しない
+	TranslateMermaidLabels bool          // Mermaidのフローチャートとシーケンス図のラベルをDiagramLabelとして翻訳の対象にする
+	HeadingAnchors         HeadingAnchor // 翻訳した見出しに元のアンカーを書き足す方法
+	JSXProps               []string      // MDXで翻訳するJSXの文字列のprops（nilならDefaultJSXProps）
+
+	Extensions      Extension             // 有効にする拡張（0ならDefaultExtensions）
+	BlockExtensions []BlockExtension      // パーサーに追加する独自のブロック（名前は重複できない）
+	Strict          bool                  // 問題のある入力をエラーにする（falseならDocument.Diagnosticsに記録して読み進める）
+	Progress        func(done, total int) // パースした行数を通知する（nilなら通知しない）
 }
 
-func ParseMarkdown(markdown string) []*Node {
-	lines := strings.Split(markdown, "\n")
-	var nodes []*Node
-	var currentParagraph []string
-	var tableParts []string
-
-	bar := pb.StartNew(len(lines))
-
-	for i := 0; i < len(lines); i++ {
-		bar.Set(i)
-
-		line := lines[i]
-		trimmedLine := strings.TrimSpace(lines[i])
-
-		if trimmedLine == "" {
-			if len(currentParagraph) > 0 {
-				text := strings.Join(currentParagraph, " ")
-
-				nestSpaceCount := 0
-				for _, ch := range text {
-					if ch == ' ' {
-						nestSpaceCount++
-					} else {
-						break
-					}
-				}
-
-				nodes = append(nodes, createNewNodeWithIndex(Node{Type: Paragraph, Text: strings.TrimSpace(text), NestSpaceCount: nestSpaceCount}, i))
-				currentParagraph = nil
-			}
-			nodes = append(nodes, createNewNodeWithIndex(Node{Type: Blank}, i))
-			continue
-		}
-
-		if strings.HasPrefix(trimmedLine, "#") {
-			nodes = append(nodes, createNewNodeWithIndex(parseHeading(trimmedLine), i))
-		} else if strings.HasPrefix(trimmedLine, "- ") {
-			nodes = append(nodes, createNewNodeWithIndex(parseItem(line), i))
-		} else if matched, _ := regexp.MatchString(`^\d+\.\s`, trimmedLine); matched {
-			nodes = append(nodes, createNewNodeWithIndex(parseOrderedItem(line), i))
-		} else if strings.HasPrefix(trimmedLine, "```") {
-			codeBlock, delta := parseCodeBlock(lines[i:])
-			nodes = append(nodes, createNewNodeWithIndex(codeBlock, i))
-			i += delta
-		} else if strings.HasPrefix(trimmedLine, "!") {
-			nodes = append(nodes, createNewNodeWithIndex(parseImage(trimmedLine), i))
-		} else if strings.HasPrefix(trimmedLine, "|") && isTableLine(trimmedLine) {
-			// テーブル行のフォーマットならtablePartsにappendする
-			tableParts = append(tableParts, trimmedLine)
-
-			// i+1番目のlinesがテーブル行のフォーマットかチェック
-			if i+1 < len(lines) && isTableLine(lines[i+1]) {
-				// i+1番目のlinesがテーブル行のフォーマットならcontinue
-				continue
-			} else {
-				// i+1番目のlinesがテーブル行のフォーマットでないならtablePartsを使ってType: TableのNodeにする
-				tableNode := buildTableNode(tableParts)
-				nodes = append(nodes, createNewNodeWithIndex(tableNode, i))
-				tableParts = nil
-			}
-		} else {
-			currentParagraph = append(currentParagraph, line)
-		}
-	}
+// 翻訳した見出しに元のアンカーを残す方法
+type HeadingAnchor int
 
-	bar.Finish()
+const (
+	AnchorNone      HeadingAnchor = iota // 書き足さない
+	AnchorAttribute                      // ## 見出し {#getting-started}
+	AnchorHTML                           // ## 見出し <a id="getting-started"></a>
+)
 
-	if len(currentParagraph) > 0 {
-		nodes = append(nodes, createNewNodeWithIndex(Node{Type: Paragraph, Text: strings.Join(currentParagraph, " ")}, len(lines)-1))
-	}
+type TaskState int
 
-	return nodes
+const (
+	NotTask       TaskState = iota // チェックボックスのない要素
+	TaskUnchecked                  // - [ ]
+	TaskChecked                    // - [x]
+)
+
+type Node struct {
+	Index            int
+	ID               string   // 祖先の見出し・種類・正規化したテキストから作る安定したID
+	Type             NodeType // どの種類のNodeか
+	Text             string   // マークダウンのテキスト
+	TranslatedText   string
+	OrderedItemNum   int
+	NestSpaceCount   int    // 箇条書きリスト要素のネストのためのスペースが何個あるか（ネストの関係はChildrenで表す）
+	HeadingLevel     int    // 見出しのレベル
+	HeadingID        string // 見出しのアンカー（翻訳前のテキストからgoldmarkのWithAutoHeadingIDと同じ方法で作ったID。{#id} があればそのID）
+	HeadingAttribute string // 見出しの後ろに書かれた属性リスト（{#id .class}。翻訳しない）
+	SetextHeading    bool   // 下線（=== や ---）で書かれた見出しかどうか
+	CodeLang         string // コードブロックの言語（フェンスで指定されていなければ推測した言語）
+	Start            int    // ソース上の開始バイト位置
+	End              int    // ソース上の終了バイト位置（末尾の改行は含まない）
+	TextStart        int    // 翻訳で置き換えるテキストの開始バイト位置
+	TextEnd          int    // 翻訳で置き換えるテキストの終了バイト位置
+	Raw              string
+	StartLine        int // 開始位置の行（1から数える）
+	StartColumn      int // 開始位置の列（1から数えるバイト単位の列）
+	EndLine          int // 終了位置の行
+	EndColumn        int // 終了位置の列（範囲の最後の文字の次の列）
+
+	Children      []*Node   // 子要素（リストの要素やリスト要素内のブロック）
+	ListMarker    byte      // 箇条書きリストの記号（'-', '*', '+'）
+	ListDelimiter byte      // 番号付きリストの番号の後の区切り文字（'.', ')'）
+	ListStart     int       // 番号付きリストの開始番号
+	ListTight     bool      // 要素の間に空行のないリストかどうか
+	Task          TaskState // タスクリストのチェックボックスの状態
+
+	AdmonitionKind string // アドモニションの種類（NOTE, tip など。翻訳しない）
+
+	BlockName string // CustomBlockの名前（BlockExtension.Name）
+
+	CodeFenceChar   byte   // コードフェンスの文字（'`' または '~'）
+	CodeFenceLength int    // コードフェンスの文字数
+	CodeInfo        string // コードフェンスの後の情報文字列（```go title="x" の go title="x"）
+	CodeAttributes  string // 情報文字列のうち言語より後ろの部分（title="x"）
+	DiagramKind     string // コードブロックが図なら種類（mermaid, plantuml）。言語の推測はしない
+
+	FrontMatterFormat FrontMatterFormat // フロントマターの形式
+	FrontMatterKey    string            // FrontMatterValueのキー
+
+	TableAlignments []Alignment // テーブルの列ごとの配置
+	TableRow        int         // TableCellの行（0が見出しの行、区切りの行は数えない）
+	TableColumn     int         // TableCellの列
+
+	Label string // 脚注やリンク参照定義のラベル、JSXPropの名前、略語
+
+	NoTranslate bool // notranslateの印で翻訳の対象から外されたかどうか
+
+	parent    *Node
+	container bool                // 自身のソースの行を持たず子要素だけを持つNodeかどうか
+	fragment  bool                // 親のNodeの行の一部分だけを表すNodeかどうか
+	escape    func(string) string // 部分Nodeの翻訳を親のソースに書き戻すとき（とアドモニションのタイトル）のエスケープ
+	anchor    string              // 翻訳した見出しの後ろに書き足すアンカー
+	headings  []*Node             // 祖先の見出し（文書の先頭に近い順）
 }
 
-func parseHeading(line string) Node {
-	level, nestSpaceCount := 0, 0
-	for i, ch := range line {
-		if ch == '#' {
-			level++
-			if i+1 < len(line) && string(line[i+1]) == " " {
-				break
-			}
-		} else if ch == ' ' {
-			nestSpaceCount++
-		} else {
-			break
-		}
-	}
-	return Node{Type: Heading, Text: strings.TrimSpace(line[level+nestSpaceCount:]), HeadingLevel: level, NestSpaceCount: nestSpaceCount}
+func ParseMarkdown(markdown string) []*Node {
+	return ParseMarkdownWithOptions(markdown, Options{})
 }
 
-func parseItem(line string) Node {
-	// lineの-からテキストが始まるまでの空白の数を1つにする
-	hyphenIdx := strings.Index(line, "-")
-	nestSpaceCount := len(line[:hyphenIdx])
-	text := strings.TrimSpace(line[hyphenIdx+1:])
-	return Node{Type: Item, Text: text, NestSpaceCount: nestSpaceCount}
+func ParseMarkdownWithOptions(markdown string, opts Options) []*Node {
+	return Flatten(ParseMarkdownTreeWithOptions(markdown, opts))
 }
 
-func parseOrderedItem(line string) Node {
-	dotIdx := strings.Index(line, ".")
+// リストの入れ子をChildrenで表したツリーを返す
+func ParseMarkdownTree(markdown string) *Node {
+	return ParseMarkdownTreeWithOptions(markdown, Options{})
+}
 
-	orderNum, err := strconv.Atoi(strings.TrimSpace(line[:dotIdx]))
+// 問題のある入力も読み飛ばしてツリーを返す（診断が必要ならParseを使う）
+// Options.BlockExtensionsが正しくなければpanicする
+func ParseMarkdownTreeWithOptions(markdown string, opts Options) *Node {
+	opts.Strict = false
+	doc, err := Parse(strings.NewReader(markdown), opts)
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
 	}
-
-	orderIdx := strings.Index(line, fmt.Sprintf("%d.", orderNum)) // 始端のidxを返す
-
-	nestSpaceCount := len(line[:orderIdx])
-
-	return Node{Type: OrderedItem, Text: strings.TrimSpace(line[dotIdx+1:]), OrderedItemNum: orderNum, NestSpaceCount: nestSpaceCount}
+	return doc.Root
 }
 
-func parseCodeBlock(lines []string) (Node, int) {
-	nestSpaceCount := len(lines[0]) - len(strings.TrimSpace(lines[0]))
-	var codeLines []string
-	i := 1
-	for ; i < len(lines); i++ {
-		if strings.TrimSpace(lines[i]) == "```" {
-			break
-		}
-		codeLines = append(codeLines, lines[i])
+// ツリーをソースの順に並べたスライスにする（コンテナ自身は含まない）
+func Flatten(node *Node) []*Node {
+	var nodes []*Node
+	if !node.container {
+		nodes = append(nodes, node)
 	}
-	code := strings.Join(codeLines, "\n")
-
-	return Node{Type: CodeBlock, Text: code, NestSpaceCount: nestSpaceCount}, i
-}
-
-func parseImage(line string) Node {
-	nestSpaceCount := len(line) - len(strings.TrimSpace(line))
-	return Node{Type: Image, Text: strings.TrimSpace(line), NestSpaceCount: nestSpaceCount}
+	for _, child := range node.Children {
+		nodes = append(nodes, Flatten(child)...)
+	}
+	return nodes
 }
 
-func isTableLine(line string) bool {
-	return strings.HasPrefix(line, "|")
+// 自身のソースの行を持たず子要素だけを持つNodeかどうか
+func (n *Node) IsContainer() bool {
+	return n.container
 }
 
-func buildTableNode(lines []string) Node {
-	nestSpaceCount := len(lines[0]) - len(strings.TrimSpace(lines[0]))
-	return Node{Type: Table, Text: strings.Join(lines, "\n"), NestSpaceCount: nestSpaceCount}
+// 親のNodeの行の一部分だけを表すNodeかどうか
+func (n *Node) IsFragment() bool {
+	return n.fragment
 }
 
 func createNewNodeWithIndex(node Node, index int) *Node {
-	newNode := Node{
-		Index:          index,
-		Type:           node.Type,
-		Text:           node.Text,
-		TranslatedText: node.TranslatedText,
-		OrderedItemNum: node.OrderedItemNum,
-		NestSpaceCount: node.NestSpaceCount,
-		HeadingLevel:   node.HeadingLevel,
-	}
+	newNode := node
+	newNode.Index = index
 	return &newNode
 }
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// $$ で始まる行（$$ x $$ のように1行で閉じることもある）
+var mathBlockPattern = regexp.MustCompile(`^ {0,3}\$\$`)
+
+var kindMathBlock = ast.NewNodeKind("MathBlock")
+
+// $$ で囲まれた数式を表すgoldmarkのブロック
+type mathBlock struct {
+	ast.BaseBlock
+	opener text.Segment
+	last   text.Segment // 閉じる $$ の行（閉じていなければ最後の行）
+	closed bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind {
+	return kindMathBlock
+}
+
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type mathBlockParser struct {
+}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	m := mathBlockPattern.FindIndex(line)
+	if m == nil {
+		return nil, gparser.NoChildren
+	}
+
+	node := &mathBlock{opener: segment, last: segment}
+	rest := util.TrimRightSpace(line[m[1]:])
+	if len(rest) >= 2 && bytes.HasSuffix(rest, []byte("$$")) {
+		node.closed = true
+	}
+	advanceLine(reader, line, segment)
+	return node, gparser.NoChildren
+}
+
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	math := node.(*mathBlock)
+	if math.closed {
+		return gparser.Close
+	}
+
+	line, segment := reader.PeekLine()
+	math.last = segment
+	if bytes.HasSuffix(util.TrimRightSpace(line), []byte("$$")) {
+		math.closed = true
+		advanceLine(reader, line, segment)
+		return gparser.Close
+	}
+	advanceLine(reader, line, segment)
+	return gparser.Continue | gparser.NoChildren
+}
+
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func mathBlockParsers() []util.PrioritizedValue {
+	return []util.PrioritizedValue{
+		util.Prioritized(&mathBlockParser{}, 750),
+	}
+}
+
+// 数式のブロックは翻訳しない
+func (b *nodeBuilder) walkMathBlock(n *mathBlock) {
+	first := b.lineOf(n.opener.Start)
+	last := b.lineOf(n.last.Start)
+	if !n.closed {
+		b.diagnose(n.opener.Start, "math block is not closed")
+	}
+
+	var texts []string
+	for i := first; i <= last; i++ {
+		texts = append(texts, b.lineText(i))
+	}
+	b.emit(Node{
+		Type:           MathBlock,
+		Text:           strings.Join(texts, "\n"),
+		NestSpaceCount: b.nestSpaceCount(first),
+		TextStart:      b.lines[first].end,
+		TextEnd:        b.lines[first].end,
+	}, first, last)
+}
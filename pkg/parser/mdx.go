@@ -0,0 +1,309 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Options.JSXPropsを指定しなかったときに翻訳するJSXの文字列のprops
+var DefaultJSXProps = []string{"label", "title"}
+
+var (
+	// import / export の行（MDXのESM）
+	esmPattern = regexp.MustCompile(`^(?:import|export)\s`)
+	// <Tabs> </Tabs> <> </> のようなJSXの要素（小文字のHTMLの要素はHTMLブロックとして扱う）
+	jsxTagStartPattern = regexp.MustCompile(`^</?(?:[A-Z][\w.:-]*|>)`)
+)
+
+var kindMDXBlock = ast.NewNodeKind("MDXBlock")
+
+// MDXのESMの行とJSXの要素・式だけの行を表すgoldmarkのブロック
+type mdxBlock struct {
+	ast.BaseBlock
+	esm       bool
+	first     text.Segment
+	last      text.Segment
+	starts    []int // JSXの要素が始まる位置（続くJSXだけの行もまとめる）
+	remaining int   // JSXの要素が続く残りの行数
+}
+
+func (n *mdxBlock) Kind() ast.NodeKind {
+	return kindMDXBlock
+}
+
+func (n *mdxBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// JSXの要素の文字列のprops（label="..."）の値の範囲
+type jsxProp struct {
+	name       string
+	start, end int
+	quote      byte
+}
+
+// posから始まるJSXのタグか {式} の終わりの位置を返す（JSXでなければ-1）
+func scanJSX(source []byte, pos int, props *[]jsxProp) int {
+	if pos >= len(source) {
+		return -1
+	}
+	if source[pos] == '{' {
+		return scanJSXExpression(source, pos)
+	}
+	if !jsxTagStartPattern.Match(source[pos:]) {
+		return -1
+	}
+
+	i := pos + 1
+	for i < len(source) && source[i] != '>' {
+		switch c := source[i]; {
+		case c == '"' || c == '\'':
+			end := indexByteFrom(source, i+1, c)
+			if end < 0 {
+				return -1
+			}
+			// 直前の name= からpropの名前を取り出す
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(string(source[pos:i])), "="))
+			if j := strings.LastIndexAny(name, " \t\n"); j >= 0 {
+				name = name[j+1:]
+			}
+			if props != nil {
+				*props = append(*props, jsxProp{name: name, start: i + 1, end: end, quote: c})
+			}
+			i = end + 1
+		case c == '{':
+			end := scanJSXExpression(source, i)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	if i >= len(source) {
+		return -1
+	}
+	return i + 1
+}
+
+// 対応する } の次の位置を返す（文字列の中の括弧は数えない）
+func scanJSXExpression(source []byte, pos int) int {
+	depth := 0
+	for i := pos; i < len(source); i++ {
+		switch c := source[i]; c {
+		case '/':
+			// {/* コメント */}
+			if i+1 < len(source) && source[i+1] == '*' {
+				end := strings.Index(string(source[i+2:]), "*/")
+				if end < 0 {
+					return -1
+				}
+				i += 2 + end + 1
+			}
+		case '"', '\'', '`':
+			end := indexByteFrom(source, i+1, c)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+func indexByteFrom(source []byte, pos int, c byte) int {
+	for i := pos; i < len(source); i++ {
+		if source[i] == '\\' {
+			i++
+			continue
+		}
+		if source[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// posの行がJSXの要素か {式} だけでできていれば、それらが終わる行の終わりの位置を返す（違えば-1）
+func jsxBlockEnd(source []byte, pos int, props *[]jsxProp) int {
+	i := pos
+	for {
+		end := scanJSX(source, i, props)
+		if end < 0 {
+			return -1
+		}
+		i = end
+		for i < len(source) && (source[i] == ' ' || source[i] == '\t' || source[i] == '\r') {
+			i++
+		}
+		if i >= len(source) || source[i] == '\n' {
+			return i
+		}
+	}
+}
+
+// 文書の先頭か空行の次の行かどうか（ESMは段落の途中には書けない）
+func afterBlankLine(source []byte, start int) bool {
+	if start == 0 {
+		return true
+	}
+	previous := source[:start-1]
+	return util.IsBlank(previous[strings.LastIndexByte(string(previous), '\n')+1:])
+}
+
+type mdxBlockParser struct {
+}
+
+func (p *mdxBlockParser) Trigger() []byte {
+	return []byte{'<', '{', 'i', 'e'}
+}
+
+func (p *mdxBlockParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, gparser.NoChildren
+	}
+
+	if esmPattern.Match(line) && parent.Kind() == ast.KindDocument && afterBlankLine(reader.Source(), segment.Start) {
+		node := &mdxBlock{esm: true, first: segment, last: segment}
+		advanceLine(reader, line, segment)
+		return node, gparser.NoChildren
+	}
+
+	start := segment.Start + pos - segment.Padding
+	end := jsxBlockEnd(reader.Source(), start, nil)
+	if end < 0 {
+		return nil, gparser.NoChildren
+	}
+	node := &mdxBlock{first: segment, last: segment, starts: []int{start}}
+	node.remaining = strings.Count(string(reader.Source()[start:end]), "\n")
+	advanceLine(reader, line, segment)
+	return node, gparser.NoChildren
+}
+
+func (p *mdxBlockParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	mdx := node.(*mdxBlock)
+	line, segment := reader.PeekLine()
+	if mdx.esm {
+		// ESMは空行まで続く
+		if util.IsBlank(line) {
+			return gparser.Close
+		}
+	} else if mdx.remaining > 0 {
+		mdx.remaining--
+	} else {
+		// 次の行もJSXの要素だけなら同じブロックにする
+		start := segment.Start + util.TrimLeftSpaceLength(line)
+		end := jsxBlockEnd(reader.Source(), start, nil)
+		if util.IsBlank(line) || end < 0 {
+			return gparser.Close
+		}
+		mdx.starts = append(mdx.starts, start)
+		mdx.remaining = strings.Count(string(reader.Source()[start:end]), "\n")
+	}
+	mdx.last = segment
+	advanceLine(reader, line, segment)
+	return gparser.Continue | gparser.NoChildren
+}
+
+func (p *mdxBlockParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *mdxBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *mdxBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func mdxBlockParsers() []util.PrioritizedValue {
+	return []util.PrioritizedValue{
+		util.Prioritized(&mdxBlockParser{}, 750),
+	}
+}
+
+// ESMとJSXは翻訳しない（許可したpropsの文字列だけをJSXPropの子にする）
+func (b *nodeBuilder) walkMDXBlock(n *mdxBlock) {
+	first := b.lineOf(n.first.Start)
+	last := b.lineOf(n.last.Start)
+
+	var texts []string
+	for i := first; i <= last; i++ {
+		texts = append(texts, b.lineText(i))
+	}
+	nodeType := JSX
+	if n.esm {
+		nodeType = ESM
+	}
+	node := b.emit(Node{
+		Type:           nodeType,
+		Text:           strings.Join(texts, "\n"),
+		NestSpaceCount: b.nestSpaceCount(first),
+		TextStart:      b.lines[first].end,
+		TextEnd:        b.lines[first].end,
+	}, first, last)
+	if node == nil || n.esm {
+		return
+	}
+
+	keys := b.opts.JSXProps
+	if keys == nil {
+		keys = DefaultJSXProps
+	}
+	targets := map[string]bool{}
+	for _, key := range keys {
+		targets[key] = true
+	}
+
+	var props []jsxProp
+	for _, start := range n.starts {
+		jsxBlockEnd(b.source, start, &props)
+	}
+	for _, prop := range props {
+		if !targets[prop.name] || prop.start == prop.end {
+			continue
+		}
+		value := string(b.source[prop.start:prop.end])
+		escape := escapeJSXDoubleQuoted
+		if prop.quote == '\'' {
+			escape = escapeJSXSingleQuoted
+		}
+		node.Children = append(node.Children, &Node{
+			Index:     b.lineOf(prop.start),
+			Type:      JSXProp,
+			Text:      value,
+			Start:     prop.start,
+			End:       prop.end,
+			TextStart: prop.start,
+			TextEnd:   prop.end,
+			Raw:       value,
+			Label:     prop.name,
+			parent:    node,
+			fragment:  true,
+			escape:    escape,
+		})
+	}
+}
+
+func escapeJSXDoubleQuoted(s string) string {
+	return strings.NewReplacer("&", "&amp;", `"`, "&quot;", "\n", " ").Replace(s)
+}
+
+func escapeJSXSingleQuoted(s string) string {
+	return strings.NewReplacer("&", "&amp;", "'", "&#39;", "\n", " ").Replace(s)
+}
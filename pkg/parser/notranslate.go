@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	noTranslateOpen  = regexp.MustCompile(`^<!--\s*notranslate\s*-->$`)
+	noTranslateClose = regexp.MustCompile(`^<!--\s*/notranslate\s*-->$`)
+	// {: .notranslate} （kramdownの属性リスト）と {.notranslate}
+	noTranslateAttribute = regexp.MustCompile(`(?:^|\s)\{:?\s*(?:[^{}]*\s)?\.notranslate(?:\s[^{}]*)?\}$`)
+)
+
+// notranslateの印が付いたNodeのNoTranslateをtrueにする
+//   - <!-- notranslate --> から <!-- /notranslate --> までのNode
+//   - 末尾や直後の行に {: .notranslate} があるブロック
+//   - テキスト全体が <span translate="no"> で囲まれたNode（一部だけならProtectInlineで守る）
+func (b *nodeBuilder) markNoTranslate(root *Node) {
+	markNoTranslateAttributes(root)
+
+	var opens []*Node
+	for _, node := range Flatten(root) {
+		if node.Type == HTMLBlock {
+			marker := strings.TrimSpace(node.Raw)
+			switch {
+			case noTranslateOpen.MatchString(marker):
+				opens = append(opens, node)
+				continue
+			case noTranslateClose.MatchString(marker):
+				if len(opens) == 0 {
+					b.diagnose(node.Start, "%s has no matching <!-- notranslate -->", marker)
+				} else {
+					opens = opens[:len(opens)-1]
+				}
+				continue
+			}
+		}
+
+		if len(opens) > 0 || isNoTranslateInline(node.Text) {
+			node.NoTranslate = true
+		}
+	}
+	for _, open := range opens {
+		b.diagnose(open.Start, "<!-- notranslate --> is not closed")
+	}
+}
+
+// {: .notranslate} の付いたブロックとその子孫に印を付ける
+func markNoTranslateAttributes(parent *Node) {
+	var previous *Node
+	for _, child := range parent.Children {
+		if child.fragment {
+			continue
+		}
+		if text := strings.TrimSpace(child.Text); isTextNode(child) && noTranslateAttribute.MatchString(text) {
+			// 属性リストだけの段落は直前のブロックに付く
+			if child.Type == Paragraph && strings.HasPrefix(text, "{") && previous != nil {
+				markNoTranslateTree(previous)
+			}
+			markNoTranslateTree(child)
+		}
+		markNoTranslateAttributes(child)
+
+		if child.Type != Blank {
+			previous = child
+		}
+	}
+}
+
+func markNoTranslateTree(node *Node) {
+	node.NoTranslate = true
+	for _, child := range node.Children {
+		markNoTranslateTree(child)
+	}
+}
+
+func isTextNode(node *Node) bool {
+	switch node.Type {
+	case Heading, Paragraph, Item, OrderedItem, Admonition, Footnote, DefinitionTerm, DefinitionDescription:
+		return true
+	}
+	return false
+}
+
+// テキストに <span translate="no"> の中身しか翻訳するものがないかどうか
+func isNoTranslateInline(text string) bool {
+	if !strings.Contains(text, "<span") {
+		return false
+	}
+
+	protected := ProtectInline(text)
+	hasSpan := false
+	for _, placeholder := range protected.Placeholders {
+		if i := strings.Index(placeholder.Original, "<span"); i >= 0 && noTranslateSpanEnd(placeholder.Original[i:]) > 0 {
+			hasSpan = true
+		}
+	}
+	if !hasSpan {
+		return false
+	}
+
+	rest := placeholderPattern.ReplaceAllString(protected.Text, "")
+	return strings.IndexFunc(rest, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) < 0
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Extension int
+
+const (
+	ExtTable            Extension = 1 << iota // GFMのテーブル
+	ExtTaskList                               // GFMのタスクリスト
+	ExtFrontMatter                            // YAML・TOMLのフロントマター
+	ExtAdmonition                             // MkDocs・Docusaurusのアドモニション
+	ExtFootnote                               // 脚注の定義
+	ExtMath                                   // $$ で囲まれた数式のブロック
+	ExtHeadingAttribute                       // 見出しの後ろの {#id .class}
+	ExtMDX                                    // MDXのESMとJSX（DefaultExtensionsには含まない）
+	ExtDefinitionList                         // PHP Markdown Extraの定義リスト
+	ExtAbbreviation                           // PHP Markdown Extraの略語の定義
+
+	DefaultExtensions = ExtTable | ExtTaskList | ExtFrontMatter | ExtAdmonition | ExtFootnote | ExtMath | ExtHeadingAttribute | ExtDefinitionList | ExtAbbreviation
+)
+
+// 入力の問題の位置と内容
+type Diagnostic struct {
+	Line    int // 1から始まる行
+	Column  int // 1から始まるバイト単位の列
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Options.Strictのときに問題のある入力に対して返すエラー
+type ParseError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	var messages []string
+	for _, d := range e.Diagnostics {
+		messages = append(messages, d.String())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// パースの結果
+type Document struct {
+	Root        *Node   // ツリーの根
+	Nodes       []*Node // ソースの順に並べたNode（Flatten(Root)）
+	Source      string
+	Diagnostics []Diagnostic // 寛容モードで読み飛ばした入力の問題
+}
+
+// rを読んでパースする。Options.Strictなら問題のある入力に対して*ParseErrorを返す
+func Parse(r io.Reader, opts Options) (*Document, error) {
+	if err := validateBlockExtensions(opts.BlockExtensions); err != nil {
+		return nil, err
+	}
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newNodeBuilder(source, opts)
+	if opts.Progress != nil {
+		total := len(b.lines)
+		b.onProgress = func(line int) {
+			opts.Progress(line+1, total)
+		}
+	}
+	root := b.build()
+	b.setPositions(root)
+	b.markNoTranslate(root)
+	nodes := Flatten(root)
+	assignIDs(nodes)
+	if opts.Progress != nil {
+		opts.Progress(len(b.lines), len(b.lines))
+	}
+
+	doc := &Document{
+		Root:        root,
+		Nodes:       nodes,
+		Source:      string(source),
+		Diagnostics: b.diagnostics,
+	}
+	if opts.Strict && len(b.diagnostics) > 0 {
+		return doc, &ParseError{Diagnostics: b.diagnostics}
+	}
+	return doc, nil
+}
+
+// バイト位置から行と列を求めてツリーのすべてのNodeに記録する
+func (b *nodeBuilder) setPositions(node *Node) {
+	line := b.lineOf(node.Start)
+	node.StartLine, node.StartColumn = line+1, node.Start-b.lines[line].start+1
+	line = b.lineOf(node.End)
+	node.EndLine, node.EndColumn = line+1, node.End-b.lines[line].start+1
+	for _, child := range node.Children {
+		b.setPositions(child)
+	}
+}
+
+// posのバイト位置の問題を記録する
+func (b *nodeBuilder) diagnose(pos int, format string, args ...interface{}) {
+	line := b.lineOf(pos)
+	b.diagnostics = append(b.diagnostics, Diagnostic{
+		Line:    line + 1,
+		Column:  pos - b.lines[line].start + 1,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
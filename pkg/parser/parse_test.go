@@ -0,0 +1,518 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseReportsDiagnostics(t *testing.T) {
+	source := "# Title\n\n| a | b |\n|---|---|\n| 1 | 2 | 3 |\n\n```go\nfunc main() {\n"
+
+	doc, err := Parse(strings.NewReader(source), Options{})
+	if err != nil {
+		t.Fatalf("lenient mode should not fail: %v", err)
+	}
+	expected := []string{
+		"5:11: table row has 3 cells but the header has 2",
+		"7:1: code fence \"```\" is not closed",
+	}
+	if len(doc.Diagnostics) != len(expected) {
+		t.Fatalf("unexpected diagnostics: %v", doc.Diagnostics)
+	}
+	for i, d := range doc.Diagnostics {
+		if d.String() != expected[i] {
+			t.Errorf("diagnostic %d:\n got: %s\nwant: %s", i, d, expected[i])
+		}
+	}
+	if got := NodesToMarkdownWithMode(doc.Nodes, RenderSource); got != source {
+		t.Errorf("lenient mode should keep the whole document:\n%s", diffLines(source, got))
+	}
+
+	_, err = Parse(strings.NewReader(source), Options{Strict: true})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || len(parseErr.Diagnostics) != len(expected) {
+		t.Fatalf("strict mode should return a ParseError, got %v", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	source := "---\ntitle: Hello\n---\n\n| a |\n|---|\n| 1 |\n"
+
+	var done, total int
+	doc, err := Parse(strings.NewReader(source), Options{
+		Extensions: ExtTaskList,
+		Progress: func(d, t int) {
+			done, total = d, t
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done != total || total != 8 {
+		t.Errorf("progress should reach the last line: %d/%d", done, total)
+	}
+	for _, node := range doc.Nodes {
+		if node.Type == FrontMatter || node.Type == Table {
+			t.Errorf("disabled extension produced %s", node)
+		}
+	}
+}
+
+func TestParseMarksNoTranslate(t *testing.T) {
+	source := `# Title
+
+<!-- notranslate -->
+Copyright (c) The Authors.
+
+- Permission is granted
+<!-- /notranslate -->
+
+Keep this API name
+{: .notranslate}
+
+| a | b |
+|---|---|
+| 1 | 2 |
+
+{: .notranslate}
+
+<span translate="no">Error: file not found</span>
+
+Call <span translate="no">Open File</span> to start.
+
+<div translate="no"><p>Quoted error</p></div>
+<p>Translated</p>
+`
+	doc, err := Parse(strings.NewReader(source), Options{TranslateHTMLText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var translated, skipped []string
+	for _, node := range doc.Nodes {
+		if node.Text == "" || node.Type == Blank || node.Type == HTMLBlock || node.Type == Table {
+			continue
+		}
+		if node.NoTranslate {
+			skipped = append(skipped, node.Text)
+		} else {
+			translated = append(translated, node.Text)
+		}
+	}
+
+	expectedTranslated := []string{"Title", "Call <span translate=\"no\">Open File</span> to start.", "Translated"}
+	expectedSkipped := []string{"Copyright (c) The Authors.", "Permission is granted", "Keep this API name {: .notranslate}", "a", "b", "1", "2", "{: .notranslate}", "<span translate=\"no\">Error: file not found</span>"}
+	if strings.Join(translated, "|") != strings.Join(expectedTranslated, "|") {
+		t.Errorf("translated nodes:\n got: %q\nwant: %q", translated, expectedTranslated)
+	}
+	if strings.Join(skipped, "|") != strings.Join(expectedSkipped, "|") {
+		t.Errorf("skipped nodes:\n got: %q\nwant: %q", skipped, expectedSkipped)
+	}
+
+	protected := ProtectInline(expectedTranslated[1])
+	if protected.Text != "Call ⟦0⟧ to start." {
+		t.Errorf("inline notranslate span should be one placeholder, got %q", protected.Text)
+	}
+
+	doc, _ = Parse(strings.NewReader("<!-- notranslate -->\ntext\n"), Options{})
+	if len(doc.Diagnostics) != 1 || doc.Diagnostics[0].String() != "1:1: <!-- notranslate --> is not closed" {
+		t.Errorf("unexpected diagnostics: %v", doc.Diagnostics)
+	}
+}
+
+func TestParseHeadingPath(t *testing.T) {
+	source := `---
+title: Guide
+---
+
+# Install
+
+## Linux
+
+Run the script.
+
+# Usage
+
+Open the app.
+`
+	nodes := ParseMarkdown(source)
+	if title := DocumentTitle(nodes); title != "Guide" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if title := DocumentTitle(ParseMarkdown("Intro\n\n# Guide\n")); title != "Guide" {
+		t.Errorf("unexpected title %q without front matter", title)
+	}
+
+	paths := map[string]string{}
+	for _, node := range nodes {
+		if node.Type != Paragraph {
+			continue
+		}
+		var path []string
+		for _, heading := range node.HeadingPath() {
+			path = append(path, heading.Text)
+		}
+		paths[node.Text] = strings.Join(path, " > ")
+	}
+	if paths["Run the script."] != "Install > Linux" || paths["Open the app."] != "Usage" {
+		t.Errorf("unexpected heading paths %q", paths)
+	}
+}
+
+func TestPreviousPassages(t *testing.T) {
+	source := `---
+title: Guide
+---
+
+# Install
+
+| Name | Desc |
+|---|---|
+| tool | A command line tool |
+
+First paragraph.
+
+- An item
+
+Second paragraph.
+`
+	nodes := ParseMarkdown(source)
+	last := len(nodes) - 1
+	for nodes[last].Text != "Second paragraph." {
+		last--
+	}
+
+	var texts []string
+	for _, node := range PreviousPassages(nodes, last, 5) {
+		texts = append(texts, node.Text)
+	}
+	if got := strings.Join(texts, " | "); got != "First paragraph. | An item" {
+		t.Errorf("only paragraphs and items should be passages: %s", got)
+	}
+
+	texts = nil
+	for _, node := range PreviousPassages(nodes, last, 1) {
+		texts = append(texts, node.Text)
+	}
+	if got := strings.Join(texts, " | "); got != "An item" {
+		t.Errorf("the nearest passages should be kept: %s", got)
+	}
+}
+
+func TestParseMarkdownTree(t *testing.T) {
+	source := "3. First\n\n   - Nested\n   - Items\n\n4. Second\n\n   ```go\n   fmt.Println()\n   ```\n\n   More text.\n"
+
+	var dump func(node *Node, depth int) []string
+	dump = func(node *Node, depth int) []string {
+		var lines []string
+		for _, child := range node.Children {
+			if child.Type == Blank {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s%s %q", strings.Repeat("  ", depth), child.Type, child.Text))
+			lines = append(lines, dump(child, depth+1)...)
+		}
+		return lines
+	}
+
+	root := ParseMarkdownTree(source)
+	expected := []string{
+		`List ""`,
+		`  OrderedItem "First"`,
+		`    List ""`,
+		`      Item "Nested"`,
+		`      Item "Items"`,
+		`  OrderedItem "Second"`,
+		`    CodeBlock "fmt.Println()"`,
+		`    Paragraph "More text."`,
+	}
+	if got := dump(root, 0); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected tree:\n%s", strings.Join(got, "\n"))
+	}
+
+	outer := root.Children[0]
+	if !outer.IsContainer() || outer.ListStart != 3 || outer.ListTight || outer.ListDelimiter != '.' {
+		t.Errorf("unexpected outer list %+v", outer)
+	}
+	var inner *Node
+	for _, child := range outer.Children[0].Children {
+		if child.Type == List {
+			inner = child
+		}
+	}
+	if inner == nil || !inner.ListTight || inner.ListMarker != '-' {
+		t.Errorf("unexpected inner list %+v", inner)
+	}
+	for _, item := range inner.Children {
+		if item.parent != inner {
+			t.Errorf("%s should point to its list", item)
+		}
+	}
+
+	// Flattenはコンテナを除いてソースの順に並べる
+	var types []string
+	for _, node := range Flatten(root) {
+		if node.Type != Blank {
+			types = append(types, node.Type.String())
+		}
+	}
+	if got := strings.Join(types, " "); got != "OrderedItem Item Item OrderedItem CodeBlock Paragraph" {
+		t.Errorf("unexpected flattened nodes: %s", got)
+	}
+}
+
+func TestParseHTMLBlocksAndIndentedCode(t *testing.T) {
+	source := "Intro.\n\n    indented code\n    more\n\n<details>\n<summary>More info</summary>\nHidden <b>bold</b> text with <code>x</code>.\n<pre>keep this</pre>\n</details>\n"
+
+	texts := func(opts Options) map[NodeType][]string {
+		texts := map[NodeType][]string{}
+		for _, node := range ParseMarkdownWithOptions(source, opts) {
+			texts[node.Type] = append(texts[node.Type], node.Text)
+		}
+		return texts
+	}
+
+	// HTMLブロックは既定では翻訳しない
+	defaults := texts(Options{})
+	if fmt.Sprintf("%q", defaults[IndentedCode]) != `["indented code\nmore"]` {
+		t.Errorf("unexpected indented code %q", defaults[IndentedCode])
+	}
+	if len(defaults[HTMLBlock]) != 1 || len(defaults[HTMLText]) != 0 {
+		t.Errorf("HTML block should not be translated by default: %q", defaults)
+	}
+
+	// Options.TranslateHTMLTextのときはインライン要素を含む文を1つのHTMLTextにする
+	html := texts(Options{TranslateHTMLText: true})
+	if got := fmt.Sprintf("%q", html[HTMLText]); got != `["More info" "Hidden <b>bold</b> text with <code>x</code>."]` {
+		t.Errorf("unexpected HTML texts %s", got)
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	source := "# Title\n\nfirst line\nsecond line\n\n- item\n\n| a | b |\n|---|---|\n| 1 | 2 |\n"
+	nodes := ParseMarkdown(source)
+
+	positions := map[string]string{
+		"Title":                  "1:1-1:8",
+		"first line second line": "3:1-4:12",
+		"item":                   "6:1-6:7",
+		"2":                      "10:7-10:8",
+	}
+	for _, node := range nodes {
+		want, ok := positions[node.Text]
+		if !ok {
+			continue
+		}
+		delete(positions, node.Text)
+		if got := node.Position(); got != want {
+			t.Errorf("%s: got %s, want %s", node, got, want)
+		}
+		if !strings.Contains(node.String(), "Pos:"+want) {
+			t.Errorf("String() does not include the position: %s", node)
+		}
+	}
+	if len(positions) > 0 {
+		t.Errorf("nodes not found: %v", positions)
+	}
+}
+
+func TestNodeIDs(t *testing.T) {
+	source := "# Install\n\n## Linux\n\nRun the “installer”.\n\n## macOS\n\nRun the \"installer\".\n\n## Windows\n\nRun   the\n\"installer\".\n"
+	nodes := ParseMarkdown(source)
+
+	var paragraphs []*Node
+	for _, node := range nodes {
+		if node.Type == Paragraph {
+			paragraphs = append(paragraphs, node)
+		}
+	}
+	if len(paragraphs) != 3 {
+		t.Fatalf("unexpected paragraphs: %v", paragraphs)
+	}
+	for _, p := range paragraphs {
+		if got := NormalizeText(p.Text); got != `Run the "installer".` {
+			t.Errorf("unexpected normalized text: %q", got)
+		}
+	}
+	if paragraphs[0].ID == paragraphs[1].ID || paragraphs[1].ID == paragraphs[2].ID {
+		t.Errorf("paragraphs under different headings should have different IDs")
+	}
+
+	// 空白や引用符の違いではIDは変わらない
+	renamed := ParseMarkdown(strings.Replace(source, "Run the “installer”.", "Run  the \"installer\".", 1))
+	for i, node := range renamed {
+		if node.ID != nodes[i].ID {
+			t.Errorf("ID of %s changed", node)
+		}
+	}
+
+	if got := NormalizeText("first  \nsecond\nthird"); got != "first\nsecond third" {
+		t.Errorf("hard breaks should be kept: %q", got)
+	}
+}
+
+func TestIsTranslationTarget(t *testing.T) {
+	source := "# Title\n\n```go\ncode\n```\n\nKeep this\n{: .notranslate}\n\n| a |\n|---|\n| 1 |\n"
+
+	var targets []string
+	for _, node := range ParseMarkdown(source) {
+		if IsTranslationTarget(node) {
+			targets = append(targets, node.Type.String()+":"+node.Text)
+		}
+	}
+	if got := strings.Join(targets, ", "); got != "Heading:Title, TableCell:a, TableCell:1" {
+		t.Errorf("unexpected targets: %s", got)
+	}
+}
+
+func TestOptionsForPath(t *testing.T) {
+	source := "import Tabs from '@theme/Tabs'\n\n<Tabs>\n\nText\n\n</Tabs>\n"
+
+	for path, want := range map[string]string{
+		"docs/intro.mdx": "Paragraph:Text",
+		"docs/intro.md":  "Paragraph:import Tabs from '@theme/Tabs', Paragraph:Text",
+	} {
+		var targets []string
+		for _, node := range ParseMarkdownWithOptions(source, OptionsForPath(path)) {
+			if IsTranslationTarget(node) {
+				targets = append(targets, node.Type.String()+":"+node.Text)
+			}
+		}
+		if got := strings.Join(targets, ", "); got != want {
+			t.Errorf("%s: unexpected targets: %s", path, got)
+		}
+	}
+}
+
+func TestOptionsForPathSkipsCodeColumns(t *testing.T) {
+	source := "| Flag | Description |\n|---|---|\n| `-v` | Verbose output |\n"
+
+	// コードの列も見出しの行は翻訳する
+	var targets []string
+	for _, node := range ParseMarkdownWithOptions(source, OptionsForPath("README.md")) {
+		if IsTranslationTarget(node) {
+			targets = append(targets, node.Text)
+		}
+	}
+	if got := strings.Join(targets, ", "); got != "Flag, Description, Verbose output" {
+		t.Errorf("code cells should be skipped by default: %s", got)
+	}
+}
+
+func TestParseHeaderOnlyTable(t *testing.T) {
+	source := "| Name | Desc |\n|---|---|\n\nAfter\n"
+	nodes := ParseMarkdown(source)
+
+	var types []string
+	translations := map[string]string{"Name": "名前", "Desc": "説明", "After": "後"}
+	for _, node := range nodes {
+		types = append(types, node.Type.String())
+		node.TranslatedText = translations[node.Text]
+	}
+	if got := strings.Join(types, ","); got != "Table,TableCell,TableCell,Blank,Paragraph,Blank" {
+		t.Fatalf("delimiter row should belong to the table: %s", got)
+	}
+
+	expected := "| 名前 | 説明 |\n| ---- | ---- |\n\n後\n"
+	if got := NodesToMarkdown(nodes); got != expected {
+		t.Errorf("unexpected output:\n got: %q\nwant: %q", got, expected)
+	}
+}
+
+func TestCheckReferencesAfterTranslation(t *testing.T) {
+	source := "See the [guide][Guide] and the note[^1].\n\n[^1]: A footnote body.\n\n[guide]: https://example.com/guide\n"
+	nodes := ParseMarkdown(source)
+
+	var types []string
+	for _, node := range nodes {
+		types = append(types, node.Type.String())
+	}
+	if got := strings.Join(types, ","); got != "Paragraph,Blank,Footnote,Blank,LinkDefinition,Blank" {
+		t.Fatalf("unexpected node types: %s", got)
+	}
+	if err := CheckReferences(nodes); err != nil {
+		t.Fatalf("source references should resolve: %v", err)
+	}
+
+	nodes[0].TranslatedText = "[ガイド][ガイド] と注釈[^１]を参照。"
+	err := CheckReferences(nodes)
+	if err == nil {
+		t.Fatal("expected broken references to be reported")
+	}
+	for _, broken := range []string{"1:1-1:41: link reference \"[ガイド][ガイド]\"", "1:1-1:41: footnote \"[^１]\""} {
+		if !strings.Contains(err.Error(), broken) {
+			t.Errorf("%s is not reported: %v", broken, err)
+		}
+	}
+}
+
+func TestCheckAnchorsAfterTranslation(t *testing.T) {
+	source := "# Getting Started\n\n## Install `go` {#setup}\n\n## Usage\n\n## Usage\n\nSee [setup](#setup), [usage](#usage-1) and [start](#getting-started).\n"
+	translations := map[string]string{
+		"Getting Started": "はじめに",
+		"Install `go`":    "`go` のインストール",
+		"Usage":           "使い方",
+	}
+
+	for _, tc := range []struct {
+		anchors  HeadingAnchor
+		expected string
+		broken   []string
+	}{
+		{AnchorNone, "# はじめに\n\n## `go` のインストール {#setup}\n\n## 使い方\n\n## 使い方\n", []string{"#usage-1", "#getting-started"}},
+		{AnchorAttribute, "# はじめに {#getting-started}\n\n## `go` のインストール {#setup}\n\n## 使い方 {#usage}\n\n## 使い方 {#usage-1}\n", nil},
+		{AnchorHTML, "# はじめに <a id=\"getting-started\"></a>\n\n## `go` のインストール {#setup}\n\n## 使い方 <a id=\"usage\"></a>\n\n## 使い方 <a id=\"usage-1\"></a>\n", nil},
+	} {
+		nodes := ParseMarkdownWithOptions(source, Options{HeadingAnchors: tc.anchors})
+		for _, node := range nodes {
+			if node.Type == Heading {
+				node.TranslatedText = translations[node.Text]
+			}
+		}
+
+		for _, mode := range []RenderMode{RenderSource, RenderNormalized} {
+			got := NodesToMarkdownWithMode(nodes, mode)
+			if !strings.HasPrefix(got, tc.expected) {
+				t.Errorf("anchors %d mode %d:\n%s", tc.anchors, mode, diffLines(tc.expected, got))
+			}
+		}
+
+		err := CheckAnchors(nodes)
+		for _, anchor := range tc.broken {
+			if err == nil || !strings.Contains(err.Error(), anchor) {
+				t.Errorf("anchors %d: expected broken link %s, got %v", tc.anchors, anchor, err)
+			}
+		}
+		if tc.broken == nil && err != nil {
+			t.Errorf("anchors %d: unexpected broken links: %v", tc.anchors, err)
+		}
+	}
+}
+
+func TestParseSetextHeadingsAndHardBreaks(t *testing.T) {
+	source := "Title\n=====\n\n***\n\nfirst line  \nsecond line\\\nthird line\nsoft\n"
+	nodes := ParseMarkdown(source)
+
+	var types []string
+	for _, node := range nodes {
+		types = append(types, node.Type.String())
+	}
+	if got := strings.Join(types, ","); got != "Heading,Blank,ThematicBreak,Blank,Paragraph,Blank" {
+		t.Fatalf("unexpected node types: %s", got)
+	}
+	if !nodes[0].SetextHeading || nodes[0].HeadingLevel != 1 || nodes[0].Text != "Title" {
+		t.Errorf("unexpected setext heading: %+v", nodes[0])
+	}
+	if want := "first line  \nsecond line\\\nthird line soft"; nodes[4].Text != want {
+		t.Fatalf("hard breaks are not kept:\n got: %q\nwant: %q", nodes[4].Text, want)
+	}
+
+	nodes[0].TranslatedText = "タイトル"
+	nodes[4].TranslatedText = "一行目  \n二行目\\\n三行目"
+	expected := "タイトル\n=====\n\n***\n\n一行目  \n二行目\\\n三行目\n"
+	if got := NodesToMarkdownWithMode(nodes, RenderSource); got != expected {
+		t.Errorf("unexpected output:\n got: %q\nwant: %q", got, expected)
+	}
+}
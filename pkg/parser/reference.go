@@ -0,0 +1,264 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	gparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	// [^1]: 脚注の本文
+	footnoteDefinitionPattern = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:[ \t]?`)
+	// [id]: https://example.com "タイトル"
+	linkDefinitionPattern = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:\s*\S`)
+	// [text][id] と [^1]
+	referencePattern  = regexp.MustCompile(`\[\^([^\]\s]+)\]|\[((?:[^\]\\]|\\.)*)\]\[((?:[^\]\\]|\\.)*)\]`)
+	labelSpacePattern = regexp.MustCompile(`\s+`)
+	// [text](#id)・href="#id"・[id]: #id のページ内リンク
+	anchorLinkPattern = regexp.MustCompile(`(?m)(?:\]\(\s*<?|href\s*=\s*["']|^ {0,3}\[[^\]]+\]:\s*<?)#([^\s)"'>]+)`)
+	// <a id="x"> や <a name="x"> のHTMLのアンカー
+	htmlAnchorPattern = regexp.MustCompile(`<[A-Za-z][^>]*\s(?:id|name)\s*=\s*["']([^"']+)["']`)
+)
+
+var kindFootnoteBlock = ast.NewNodeKind("FootnoteBlock")
+
+// 脚注の定義を表すgoldmarkのブロック（本文は子要素）
+type footnoteBlock struct {
+	ast.BaseBlock
+	label  string
+	opener text.Segment
+}
+
+func (n *footnoteBlock) Kind() ast.NodeKind {
+	return kindFootnoteBlock
+}
+
+func (n *footnoteBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Label": n.label}, nil)
+}
+
+type footnoteParser struct {
+}
+
+func (p *footnoteParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *footnoteParser) Open(parent ast.Node, reader text.Reader, pc gparser.Context) (ast.Node, gparser.State) {
+	line, segment := reader.PeekLine()
+	m := footnoteDefinitionPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, gparser.NoChildren
+	}
+
+	node := &footnoteBlock{label: string(line[m[2]:m[3]]), opener: segment}
+	reader.Advance(m[1])
+	return node, gparser.HasChildren
+}
+
+// 本文は4つ以上インデントされた行が続く間
+func (p *footnoteParser) Continue(node ast.Node, reader text.Reader, pc gparser.Context) gparser.State {
+	line, _ := reader.PeekLine()
+	if util.IsBlank(line) {
+		reader.Advance(len(line) - 1)
+		return gparser.Continue | gparser.HasChildren
+	}
+
+	indent, _ := util.IndentWidth(line, reader.LineOffset())
+	if indent < 4 {
+		return gparser.Close
+	}
+	pos, padding := util.IndentPosition(line, reader.LineOffset(), 4)
+	reader.AdvanceAndSetPadding(pos, padding)
+	return gparser.Continue | gparser.HasChildren
+}
+
+func (p *footnoteParser) Close(node ast.Node, reader text.Reader, pc gparser.Context) {
+}
+
+func (p *footnoteParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *footnoteParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+func footnoteBlockParsers() []util.PrioritizedValue {
+	return []util.PrioritizedValue{
+		util.Prioritized(&footnoteParser{}, 750),
+	}
+}
+
+// 脚注の定義はFootnoteにして、最初のパラグラフをその本文にする
+func (b *nodeBuilder) walkFootnote(n *footnoteBlock) {
+	b.flush(b.firstNonBlankLine())
+
+	line := b.lineOf(n.opener.Start)
+	last := line
+	node := Node{
+		Type:           Footnote,
+		Label:          n.label,
+		NestSpaceCount: b.nestSpaceCount(line),
+		TextStart:      b.lines[line].end,
+		TextEnd:        b.lines[line].end,
+	}
+
+	first := n.FirstChild()
+	if first != nil && isTextBlock(first) {
+		if start, end, ok := b.segmentsRange(first.Lines()); ok && start == line {
+			node.Text = b.segmentsText(first.Lines())
+			node.TextStart, node.TextEnd = b.segmentsSpan(first.Lines())
+			last = end
+			first = first.NextSibling()
+		}
+	}
+
+	parent := b.parent
+	if footnote := b.emit(node, line, last); footnote != nil {
+		b.parent = footnote
+	}
+	for c := first; c != nil; c = c.NextSibling() {
+		b.walk(c)
+	}
+	b.parent = parent
+}
+
+// goldmarkが取り除いたリンク参照定義の行をLinkDefinitionにする（翻訳しない）
+func (b *nodeBuilder) emitLinkDefinition(line int) bool {
+	m := linkDefinitionPattern.FindStringSubmatch(strings.TrimLeft(b.lineText(line), " >"))
+	if m == nil {
+		return false
+	}
+	b.emit(Node{
+		Type:      LinkDefinition,
+		Text:      b.lineText(line),
+		Label:     m[1],
+		TextStart: b.lines[line].end,
+		TextEnd:   b.lines[line].end,
+	}, line, line)
+	return true
+}
+
+// リンクのラベルは大文字小文字と空白の違いを区別しない
+func normalizeLabel(label string) string {
+	return strings.ToLower(labelSpacePattern.ReplaceAllString(strings.TrimSpace(label), " "))
+}
+
+func removeCodeSpans(text string) string {
+	var removed strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] == '`' {
+			i = inlineTokenEnd(text, i, nil)
+			continue
+		}
+		removed.WriteByte(text[i])
+		i++
+	}
+	return removed.String()
+}
+
+// 翻訳後のテキストの [text][id] と [^1] がすべて定義を参照できるかを確かめる
+func CheckReferences(nodes []*Node) error {
+	links := map[string]bool{}
+	footnotes := map[string]bool{}
+	for _, node := range nodes {
+		switch node.Type {
+		case LinkDefinition:
+			links[normalizeLabel(node.Label)] = true
+		case Footnote:
+			footnotes[normalizeLabel(node.Label)] = true
+		}
+	}
+
+	var errs []error
+	for _, node := range nodes {
+		switch node.Type {
+		case CodeBlock, IndentedCode, HTMLBlock, LinkDefinition, Blank, Other:
+			continue
+		}
+
+		text := node.Text
+		if node.TranslatedText != "" {
+			text = node.TranslatedText
+		}
+		text = removeCodeSpans(text)
+
+		for _, m := range referencePattern.FindAllStringSubmatch(text, -1) {
+			switch {
+			case m[1] != "":
+				if !footnotes[normalizeLabel(m[1])] {
+					errs = append(errs, fmt.Errorf("%s: footnote %q is not defined", node.Position(), m[0]))
+				}
+			default:
+				// [text][] はテキストをラベルとして使う
+				label := m[3]
+				if label == "" {
+					label = m[2]
+				}
+				if !links[normalizeLabel(label)] {
+					errs = append(errs, fmt.Errorf("%s: link reference %q is not defined", node.Position(), m[0]))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 翻訳後のマークダウンで [text](#id) のページ内リンクのアンカーがすべて存在するかを確かめる
+func CheckAnchors(nodes []*Node) error {
+	anchors := map[string]bool{}
+	ids := gparser.NewContext().IDs()
+	for _, node := range nodes {
+		if node.Type != Heading || node.HeadingID == "" {
+			continue
+		}
+		if node.TranslatedText == "" || node.anchor != "" || explicitIDPattern.MatchString(node.HeadingAttribute) {
+			ids.Put([]byte(node.HeadingID))
+			anchors[node.HeadingID] = true
+		} else {
+			// アンカーを残さなかった見出しは翻訳したテキストからIDが作られる
+			anchors[string(ids.Generate([]byte(node.TranslatedText), ast.KindHeading))] = true
+		}
+	}
+
+	// リンクを探すNodeと翻訳後のマークダウン
+	var linkNodes []*Node
+	var markdowns []string
+	for _, node := range nodes {
+		switch node.Type {
+		case CodeBlock, IndentedCode, MathBlock, FrontMatter, Blank:
+			continue
+		}
+		if node.fragment {
+			continue
+		}
+		markdown := removeCodeSpans(nodeToSourceMarkdown(node))
+		linkNodes = append(linkNodes, node)
+		markdowns = append(markdowns, markdown)
+		for _, m := range htmlAnchorPattern.FindAllStringSubmatch(markdown, -1) {
+			anchors[m[1]] = true
+		}
+	}
+
+	var errs []error
+	for i, node := range linkNodes {
+		for _, m := range anchorLinkPattern.FindAllStringSubmatch(markdowns[i], -1) {
+			anchor, err := url.PathUnescape(m[1])
+			if err != nil {
+				anchor = m[1]
+			}
+			if !anchors[anchor] {
+				errs = append(errs, fmt.Errorf("%s: link target #%s does not exist", node.Position(), m[1]))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -26,49 +26,306 @@ func (n NodeType) String() string {
 		return "Blank"
 	case Other:
 		return "Other"
+	case Root:
+		return "Root"
+	case List:
+		return "List"
+	case IndentedCode:
+		return "IndentedCode"
+	case HTMLBlock:
+		return "HTMLBlock"
+	case HTMLText:
+		return "HTMLText"
+	case Blockquote:
+		return "Blockquote"
+	case Admonition:
+		return "Admonition"
+	case FrontMatter:
+		return "FrontMatter"
+	case FrontMatterValue:
+		return "FrontMatterValue"
+	case TableCell:
+		return "TableCell"
+	case LinkDefinition:
+		return "LinkDefinition"
+	case Footnote:
+		return "Footnote"
+	case MathBlock:
+		return "MathBlock"
+	case DiagramLabel:
+		return "DiagramLabel"
+	case ThematicBreak:
+		return "ThematicBreak"
+	case ESM:
+		return "ESM"
+	case JSX:
+		return "JSX"
+	case JSXProp:
+		return "JSXProp"
+	case DefinitionList:
+		return "DefinitionList"
+	case DefinitionTerm:
+		return "DefinitionTerm"
+	case DefinitionDescription:
+		return "DefinitionDescription"
+	case Abbreviation:
+		return "Abbreviation"
+	case CustomBlock:
+		return "CustomBlock"
 	default:
 		return "Unknown"
 	}
 }
 
 func (n Node) String() string {
-	return fmt.Sprintf("{Type:%s Text:%s NestSpaceCount:%d HeadingLevel:%d}", n.Type, n.Text, n.NestSpaceCount, n.HeadingLevel)
+	return fmt.Sprintf("{Type:%s Pos:%s Bytes:%d-%d Text:%s NestSpaceCount:%d HeadingLevel:%d}", n.Type, n.Position(), n.Start, n.End, n.Text, n.NestSpaceCount, n.HeadingLevel)
+}
+
+// ソース上の範囲を 開始行:開始列-終了行:終了列 で返す
+func (n Node) Position() string {
+	return fmt.Sprintf("%d:%d-%d:%d", n.StartLine, n.StartColumn, n.EndLine, n.EndColumn)
+}
+
+// リスト要素の記号とチェックボックスを返す
+func listItemHead(node *Node) string {
+	var head string
+	switch node.Type {
+	case Item:
+		marker := node.ListMarker
+		if marker == 0 {
+			marker = '-'
+		}
+		head = string(marker) + " "
+	case OrderedItem:
+		delimiter := node.ListDelimiter
+		if delimiter == 0 {
+			delimiter = '.'
+		}
+		head = strconv.Itoa(node.OrderedItemNum) + string(delimiter) + " "
+	}
+
+	switch node.Task {
+	case TaskUnchecked:
+		head += "[ ] "
+	case TaskChecked:
+		head += "[x] "
+	}
+	return head
+}
+
+// 祖先の引用の数だけ引用記号を返す
+func quotePrefix(node *Node) string {
+	var prefix string
+	for parent := node.parent; parent != nil; parent = parent.parent {
+		if parent.Type == Blockquote {
+			prefix += "> "
+		}
+	}
+	return prefix
 }
 
 func nodeToMarkdown(node *Node) string {
-	prefix := strings.Repeat(" ", node.NestSpaceCount)
+	quote := quotePrefix(node)
+	prefix := quote + strings.Repeat(" ", node.NestSpaceCount)
+	firstPrefix := prefix
 	text := node.Text
 	if node.TranslatedText != "" {
 		text = node.TranslatedText
 	}
 
+	// 子要素だけを持つリスト要素の最初の子にはリストの記号を付ける
+	if parent := node.parent; parent != nil && parent.container && len(parent.Children) > 0 && parent.Children[0] == node {
+		switch parent.Type {
+		case Item, OrderedItem:
+			head := strings.Repeat(" ", parent.NestSpaceCount) + listItemHead(parent)
+			firstPrefix = quote + head
+			prefix = quote + strings.Repeat(" ", len(head))
+		}
+	}
+
 	switch node.Type {
 	case Heading:
-		return prefix + strings.Repeat("#", node.HeadingLevel) + " " + text + "\n"
+		if node.TranslatedText != "" {
+			text += node.anchor
+		}
+		if node.HeadingAttribute != "" {
+			text += " " + node.HeadingAttribute
+		}
+		if node.SetextHeading {
+			underline := "==="
+			if node.HeadingLevel == 2 {
+				underline = "---"
+			}
+			return firstPrefix + text + "\n" + prefix + underline + "\n"
+		}
+		return firstPrefix + strings.Repeat("#", node.HeadingLevel) + " " + text + "\n"
 	case Paragraph:
-		return prefix + text + "\n"
-	case Item:
-		return prefix + "- " + text + "\n"
-	case OrderedItem:
-		orderNum := strconv.Itoa(node.OrderedItemNum)
-		return prefix + orderNum + ". " + text + "\n"
+		// 改行を残したパラグラフの2行目以降にもインデントを付ける
+		return firstPrefix + strings.ReplaceAll(text, "\n", "\n"+prefix) + "\n"
+	case Item, OrderedItem:
+		return firstPrefix + listItemHead(node) + text + "\n"
 	case CodeBlock:
-		return prefix + "```" + node.CodeLang + "\n" + text + "\n" + prefix + "```\n"
+		if hasTranslatedFragments(node) {
+			return nodeToSourceMarkdown(node) + "\n"
+		}
+		fence := codeBlockFence(node)
+		if text == "" {
+			return firstPrefix + fence + codeBlockInfo(node) + "\n" + prefix + fence + "\n"
+		}
+		code := prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+		return firstPrefix + fence + codeBlockInfo(node) + "\n" + code + "\n" + prefix + fence + "\n"
 	case Image:
-		return prefix + text + "\n"
+		return firstPrefix + text + "\n"
 	case Table:
-		return prefix + text + "\n"
+		if hasTranslatedFragments(node) {
+			text = rebuildTable(node)
+		}
+		return firstPrefix + strings.ReplaceAll(text, "\n", "\n"+prefix) + "\n"
 	case Blank:
 		return "\n"
+	case IndentedCode:
+		code := strings.ReplaceAll(text, "\n", "\n"+prefix+"    ")
+		return firstPrefix + "    " + code + "\n"
+	case HTMLBlock, FrontMatter, ESM, JSX:
+		return replaceFragments(node) + "\n"
+	case Admonition, MathBlock, CustomBlock:
+		return nodeToSourceMarkdown(node) + "\n"
+	case DefinitionTerm:
+		return firstPrefix + text + "\n"
+	case DefinitionDescription:
+		return firstPrefix + ": " + strings.ReplaceAll(text, "\n", "\n"+prefix+"  ") + "\n"
+	case Abbreviation:
+		return firstPrefix + "*[" + node.Label + "]: " + text + "\n"
+	case Footnote:
+		return firstPrefix + "[^" + node.Label + "]: " + text + "\n"
+	case ThematicBreak:
+		return firstPrefix + text + "\n"
+	case LinkDefinition, Other:
+		return text + "\n"
 	default:
 		return ""
 	}
 }
 
+func codeBlockFence(node *Node) string {
+	if node.CodeFenceChar == 0 || node.CodeFenceLength < 3 {
+		return "```"
+	}
+	return strings.Repeat(string(node.CodeFenceChar), node.CodeFenceLength)
+}
+
+// ソースのフェンスに情報文字列がなければ推測した言語を使う
+func codeBlockInfo(node *Node) string {
+	if node.CodeInfo != "" {
+		return node.CodeInfo
+	}
+	return node.CodeLang
+}
+
+// 翻訳された部分Node（HTMLTextなど）の範囲だけを置き換えたNodeのソースを返す
+func replaceFragments(node *Node) string {
+	var markdown strings.Builder
+	pos := 0
+	for _, child := range node.Children {
+		if !child.fragment || child.TranslatedText == "" {
+			continue
+		}
+		start, end := child.TextStart-node.Start, child.TextEnd-node.Start
+		if start < pos {
+			continue
+		}
+		translated := child.TranslatedText
+		if child.escape != nil {
+			translated = child.escape(translated)
+		}
+		markdown.WriteString(node.Raw[pos:start])
+		markdown.WriteString(translated)
+		pos = end
+	}
+	markdown.WriteString(node.Raw[pos:])
+	return markdown.String()
+}
+
+type RenderMode int
+
+const (
+	RenderNormalized RenderMode = iota // Nodeの情報からマークダウンを組み立て直す
+	RenderSource                       // 翻訳されていない部分はソースのバイト列をそのまま出力する
+)
+
+// 翻訳されたテキストの範囲だけを置き換えてNodeのソースを返す
+func nodeToSourceMarkdown(node *Node) string {
+	if node.Type == CodeBlock && node.CodeInfo == "" && node.CodeLang != "" {
+		// 言語の指定がないフェンスにだけ推測した言語を書き足す
+		if fence := codeFence(node.Raw); fence != "" {
+			raw := replaceFragments(node)
+			i := strings.Index(raw, fence) + len(fence)
+			return raw[:i] + node.CodeLang + raw[i:]
+		}
+	}
+
+	translated := node.TranslatedText
+	if node.Type == Table && translated == "" && hasTranslatedFragments(node) {
+		// テーブルはセルの翻訳で組み立て直す
+		translated = rebuildTable(node)
+	}
+	if translated == "" {
+		return replaceFragments(node)
+	}
+	if node.escape != nil && !node.fragment {
+		// アドモニションのタイトルなど、開始行の区切り文字を含む訳
+		translated = node.escape(translated)
+	}
+	if node.Type == Heading {
+		// 翻訳で変わるアンカーの代わりに元のアンカーを残す
+		translated += node.anchor
+	}
+
+	head := node.Raw[:node.TextStart-node.Start]
+	tail := node.Raw[node.TextEnd-node.Start:]
+
+	// 2行目以降は元の行頭のインデントや引用記号を引き継ぐ
+	lineHead := head[strings.LastIndex(head, "\n")+1:]
+	indent := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '>' {
+			return r
+		}
+		return ' '
+	}, lineHead)
+
+	text := strings.TrimRight(translated, "\n")
+	text = strings.ReplaceAll(text, "\n", "\n"+indent)
+
+	return head + text + tail
+}
+
 func NodesToMarkdown(nodes []*Node) string {
+	return NodesToMarkdownWithMode(nodes, RenderNormalized)
+}
+
+func NodesToMarkdownWithMode(nodes []*Node, mode RenderMode) string {
 	var markdown strings.Builder
 
+	if mode == RenderSource {
+		first := true
+		for _, node := range nodes {
+			// 部分Nodeは親のNodeと一緒に出力する
+			if node.fragment {
+				continue
+			}
+			if !first {
+				markdown.WriteString("\n")
+			}
+			markdown.WriteString(nodeToSourceMarkdown(node))
+			first = false
+		}
+		return markdown.String()
+	}
+
 	for _, node := range nodes {
+		if node.fragment {
+			continue
+		}
 		markdown.WriteString(nodeToMarkdown(node))
 	}
 
@@ -0,0 +1,439 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRoundTripCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no corpus files found")
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertRoundTrip(t, string(content))
+		})
+	}
+}
+
+func TestRoundTripEdgeCases(t *testing.T) {
+	cases := map[string]string{
+		"empty":              "",
+		"only newlines":      "\n\n\n",
+		"no trailing":        "# Title\n\ntext",
+		"crlf":               "# Title\r\n\r\nline one\r\nline two\r\n",
+		"tabs":               "-\tfoo\n\n\tcode\n\t\tmore\n",
+		"unclosed fence":     "```go\nfunc main() {\n",
+		"trailing spaces":    "para   \n   \n",
+		"empty list item":    "-\n- foo\n",
+		"empty heading":      "#\n##\n",
+		"link definitions":   "[a]: http://a\n[b]: http://b\ntext [a] [b]\n",
+		"table in paragraph": "intro\n| a | b |\n|---|---|\n| 1 | 2 |\nafter\n",
+	}
+
+	for name, source := range cases {
+		source := source
+		t.Run(name, func(t *testing.T) {
+			assertRoundTrip(t, source)
+		})
+	}
+}
+
+func TestRoundTripReplacesOnlyTranslatedSpan(t *testing.T) {
+	source := "# Title #\n\n- first item\n  continued\n- second\n\n> quoted\n> text\n"
+	nodes := ParseMarkdown(source)
+
+	for _, node := range nodes {
+		switch node.Type {
+		case Heading:
+			node.TranslatedText = "タイトル"
+		case Item:
+			if node.Text == "first item continued" {
+				node.TranslatedText = "最初の項目\n続き"
+			}
+		}
+	}
+
+	expected := "# タイトル #\n\n- 最初の項目\n  続き\n- second\n\n> quoted\n> text\n"
+	if got := NodesToMarkdownWithMode(nodes, RenderSource); got != expected {
+		t.Errorf("unexpected output:\n got: %q\nwant: %q", got, expected)
+	}
+}
+
+func TestRoundTripKeepsListMarkers(t *testing.T) {
+	source := "* [ ] star task\n+ plus\n\n3) three\n"
+	nodes := ParseMarkdown(source)
+
+	translations := map[string]string{
+		"star task": "スターのタスク",
+		"plus":      "プラス",
+		"three":     "三",
+	}
+	for _, node := range nodes {
+		node.TranslatedText = translations[node.Text]
+	}
+
+	expected := "* [ ] スターのタスク\n+ プラス\n\n3) 三\n"
+	for mode, name := range map[RenderMode]string{RenderSource: "source", RenderNormalized: "normalized"} {
+		if got := NodesToMarkdownWithMode(nodes, mode); got != expected {
+			t.Errorf("%s: unexpected output:\n got: %q\nwant: %q", name, got, expected)
+		}
+	}
+}
+
+func TestRoundTripTranslatesFrontMatterKeys(t *testing.T) {
+	cases := map[string]struct {
+		source   string
+		expected string
+	}{
+		"yaml": {
+			source:   "---\ntitle: Getting Started\ndescription: \"Say \\\"hi\\\"\"\nsummary: 'It''s easy'\nslug: getting-started\ntags: [go]\n---\n\n# Body\n",
+			expected: "---\ntitle: \"はじめに: 概要\"\ndescription: \"「hi」と言う\"\nsummary: '簡単''です'\nslug: getting-started\ntags: [go]\n---\n\n# Body\n",
+		},
+		"yaml block scalar": {
+			source:   "---\ndescription: >\n  Folded\n  text\nlayout: post\n---\n",
+			expected: "---\ndescription: >\n  一行目\n  二行目\nlayout: post\n---\n",
+		},
+		"toml": {
+			source:   "+++\ntitle = \"Getting Started\"\nsummary = 'Plain'\ndraft = false\n[params]\ntitle = \"nested\"\n+++\ntext\n",
+			expected: "+++\ntitle = \"はじめに: 概要\"\nsummary = \"It's\"\ndraft = false\n[params]\ntitle = \"nested\"\n+++\ntext\n",
+		},
+	}
+	translations := map[string]string{
+		"Getting Started": "はじめに: 概要",
+		`Say "hi"`:        "「hi」と言う",
+		"It's easy":       "簡単'です",
+		"Folded text":     "一行目\n二行目",
+		"Plain":           "It's",
+		"nested":          "入れ子",
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			nodes := ParseMarkdown(c.source)
+			if nodes[0].Type != FrontMatter {
+				t.Fatalf("first node is %s, want FrontMatter", nodes[0])
+			}
+			for _, node := range nodes {
+				if node.Type == FrontMatterValue {
+					node.TranslatedText = translations[node.Text]
+				}
+			}
+			if got := NodesToMarkdownWithMode(nodes, RenderSource); got != c.expected {
+				t.Errorf("unexpected output:\n got: %q\nwant: %q", got, c.expected)
+			}
+		})
+	}
+}
+
+func TestRoundTripRebuildsTranslatedTable(t *testing.T) {
+	source := "> | Name | Type | Notes |\n> |:-----|------|------:|\n> | `id` | int | Primary key |\n> | user_name | string | pipe \\| char |\n"
+	nodes := ParseMarkdownWithOptions(source, Options{SkipTableCodeColumns: true})
+
+	translations := map[string]string{
+		"Name":          "名前",
+		"Type":          "型",
+		"Notes":         "備考",
+		"Primary key":   "主キー",
+		"pipe \\| char": "パイプ | 文字",
+	}
+	var cells []string
+	for _, node := range nodes {
+		if node.Type == TableCell {
+			cells = append(cells, node.Text)
+			node.TranslatedText = translations[node.Text]
+		}
+	}
+	if got := strings.Join(cells, ","); got != "Name,Type,Notes,int,Primary key,string,pipe \\| char" {
+		t.Fatalf("unexpected cells: %s", got)
+	}
+
+	expected := "> | 名前      | 型     |           備考 |\n> | :-------- | ------ | -------------: |\n> | `id`      | int    |         主キー |\n> | user_name | string | パイプ \\| 文字 |\n"
+	for mode, name := range map[RenderMode]string{RenderSource: "source", RenderNormalized: "normalized"} {
+		if got := NodesToMarkdownWithMode(nodes, mode); got != expected {
+			t.Errorf("%s: unexpected output:\n got: %q\nwant: %q", name, got, expected)
+		}
+	}
+}
+
+func TestRoundTripTranslatesOnlyMermaidLabels(t *testing.T) {
+	source := "$$\nE = mc^2\n$$\n\n```mermaid\nflowchart LR\n    A[Start] -->|Yes| B(Done)\n    classDef red fill:#f00\n```\n"
+	nodes := ParseMarkdownWithOptions(source, Options{TranslateMermaidLabels: true})
+
+	if nodes[0].Type != MathBlock {
+		t.Fatalf("first node is %s, want MathBlock", nodes[0])
+	}
+
+	translations := map[string]string{
+		"Start": "開始",
+		"Yes":   "はい",
+		"Done":  "完了 (終了)",
+	}
+	var labels []string
+	for _, node := range nodes {
+		if node.Type == DiagramLabel {
+			labels = append(labels, node.Text)
+			node.TranslatedText = translations[node.Text]
+		}
+	}
+	if got := strings.Join(labels, ","); got != "Start,Yes,Done" {
+		t.Fatalf("unexpected labels: %s", got)
+	}
+
+	expected := "$$\nE = mc^2\n$$\n\n```mermaid\nflowchart LR\n    A[開始] -->|はい| B(\"完了 (終了)\")\n    classDef red fill:#f00\n```\n"
+	if got := NodesToMarkdownWithMode(nodes, RenderSource); got != expected {
+		t.Errorf("unexpected output:\n got: %q\nwant: %q", got, expected)
+	}
+}
+
+func assertRoundTrip(t *testing.T, source string) {
+	t.Helper()
+	assertRoundTripWithOptions(t, source, Options{})
+}
+
+func assertRoundTripWithOptions(t *testing.T, source string, opts Options) {
+	t.Helper()
+
+	nodes := ParseMarkdownWithOptions(source, opts)
+
+	pos := 0
+	for _, node := range nodes {
+		if node.IsFragment() {
+			// 部分Nodeは親のNodeの行の中にある
+			if node.Raw != source[node.Start:node.End] {
+				t.Fatalf("fragment %s raw mismatch: %q != %q", node, node.Raw, source[node.Start:node.End])
+			}
+			continue
+		}
+		if node.Start < pos {
+			t.Fatalf("node %s overlaps previous node: start=%d pos=%d", node, node.Start, pos)
+		}
+		if node.Raw != source[node.Start:node.End] {
+			t.Fatalf("node %s raw mismatch: %q != %q", node, node.Raw, source[node.Start:node.End])
+		}
+		pos = node.End
+	}
+
+	if got := NodesToMarkdownWithMode(nodes, RenderSource); got != source {
+		t.Errorf("round trip changed the document:\n%s", diffLines(source, got))
+	}
+}
+
+func diffLines(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("first difference at line %d:\n want: %q\n  got: %q", i+1, w, g)
+		}
+	}
+	return "documents differ only in length"
+}
+
+func TestRoundTripMDX(t *testing.T) {
+	source := `import Tabs from '@theme/Tabs';
+import TabItem from '@theme/TabItem';
+
+export const Highlight = ({children}) => (
+  <span>{children}</span>
+);
+
+# Install
+
+<Tabs groupId="os">
+  <TabItem value="mac" label="macOS" default>
+
+Run the installer.
+
+  </TabItem>
+  <TabItem
+    value="linux"
+    label={"Linux"}
+    title="Use the package manager">
+
+Use {props.tool} to install.
+
+  </TabItem>
+</Tabs>
+
+{/* don't translate this comment */}
+`
+	doc, err := Parse(strings.NewReader(source), Options{Extensions: DefaultExtensions | ExtMDX})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	translations := map[string]string{
+		"Install":                      "インストール",
+		"Run the installer.":           "インストーラーを実行する。",
+		"macOS":                        "macOS \"Apple\"",
+		"Use the package manager":      "パッケージマネージャーを使う",
+		"Use {props.tool} to install.": "{props.tool} でインストールする。",
+	}
+	for _, node := range doc.Nodes {
+		if node.Type != Blank {
+			types = append(types, node.Type.String())
+		}
+		node.TranslatedText = translations[node.Text]
+	}
+	expectedTypes := "ESM ESM Heading JSX JSXProp Paragraph JSX JSXProp Paragraph JSX JSX"
+	if got := strings.Join(types, " "); got != expectedTypes {
+		t.Fatalf("unexpected nodes:\n got: %s\nwant: %s", got, expectedTypes)
+	}
+
+	expected := strings.NewReplacer(
+		"# Install", "# インストール",
+		"Run the installer.", "インストーラーを実行する。",
+		`label="macOS"`, `label="macOS &quot;Apple&quot;"`,
+		`title="Use the package manager"`, `title="パッケージマネージャーを使う"`,
+		"Use {props.tool} to install.", "{props.tool} でインストールする。",
+	).Replace(source)
+	if got := NodesToMarkdownWithMode(doc.Nodes, RenderSource); got != expected {
+		t.Errorf("unexpected translation:\n%s", diffLines(expected, got))
+	}
+
+	if protected := ProtectInline("Use {props.tool} to install."); protected.Text != "Use ⟦0⟧ to install." {
+		t.Errorf("expression should be protected, got %q", protected.Text)
+	}
+}
+
+func TestRoundTripDefinitionListsAndCustomBlocks(t *testing.T) {
+	extensions := []BlockExtension{
+		{Name: "liquid-include", Start: regexp.MustCompile(`^\{%-?\s*include\s`), Policy: SkipBlock},
+		{Name: "liquid-capture", Start: regexp.MustCompile(`^\{%\s*capture\s`), End: regexp.MustCompile(`\{%\s*endcapture\s*%\}`), Policy: TranslateBlock},
+	}
+	duplicated := append(extensions[:2:2], BlockExtension{Name: "liquid-include", Start: regexp.MustCompile(`x`)})
+	if _, err := Parse(strings.NewReader("text\n"), Options{BlockExtensions: duplicated}); err == nil {
+		t.Error("duplicated extension name should be rejected")
+	}
+
+	source := "Apple\n:   Pomaceous fruit.\n\nOrange\n:   Citrus fruit.\n\n    Second paragraph.\n\n*[HTML]: Hyper Text Markup Language\n\n{% include note.html content=\"Keep\" %}\n\n{% capture intro %}\nWelcome to the docs.\n{% endcapture %}\n"
+	nodes := ParseMarkdownWithOptions(source, Options{BlockExtensions: extensions})
+
+	var got []string
+	translations := map[string]string{
+		"Apple":                        "りんご",
+		"Pomaceous fruit.":             "仁果。",
+		"Second paragraph.":            "2つ目の段落。",
+		"Hyper Text Markup Language":   "ハイパーテキストマークアップ言語",
+		"Welcome to the docs.":         "ドキュメントへようこそ。",
+		"{% include note.html content": "壊れる",
+	}
+	for _, node := range nodes {
+		if node.Type == Blank {
+			continue
+		}
+		got = append(got, fmt.Sprintf("%s:%s:%t", node.Type, node.Text, node.NoTranslate))
+		if !node.NoTranslate {
+			node.TranslatedText = translations[node.Text]
+		}
+	}
+	expected := []string{
+		"DefinitionTerm:Apple:false",
+		"DefinitionDescription:Pomaceous fruit.:false",
+		"DefinitionTerm:Orange:false",
+		"DefinitionDescription:Citrus fruit.:false",
+		"Paragraph:Second paragraph.:false",
+		"Abbreviation:Hyper Text Markup Language:false",
+		"CustomBlock:{% include note.html content=\"Keep\" %}:true",
+		"CustomBlock:Welcome to the docs.:false",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected nodes:\n%s", diffLines(strings.Join(expected, "\n"), strings.Join(got, "\n")))
+	}
+
+	want := "りんご\n:   仁果。\n\nOrange\n:   Citrus fruit.\n\n    2つ目の段落。\n\n*[HTML]: ハイパーテキストマークアップ言語\n\n{% include note.html content=\"Keep\" %}\n\n{% capture intro %}\nドキュメントへようこそ。\n{% endcapture %}\n"
+	if got := NodesToMarkdownWithMode(nodes, RenderSource); got != want {
+		t.Errorf("unexpected translation:\n%s", diffLines(want, got))
+	}
+	assertRoundTripWithOptions(t, source, Options{BlockExtensions: extensions})
+}
+
+func TestRoundTripEscapesHTMLText(t *testing.T) {
+	source := "<details>\n<summary>More info</summary>\nHidden <b>bold</b> text with <code>a &lt; b</code>.\n</details>\n"
+	nodes := ParseMarkdownWithOptions(source, Options{TranslateHTMLText: true})
+
+	for _, node := range nodes {
+		if node.Type != HTMLText {
+			continue
+		}
+		protected := ProtectInline(node.Text)
+		translations := map[string]string{
+			"More info": "詳細 <情報> & 補足",
+			"Hidden ⟦0⟧bold⟦1⟧ text with ⟦2⟧.": "隠れた⟦0⟧太字⟦1⟧のテキスト（⟦2⟧ &amp; x < y）。",
+		}
+		translated, ok := translations[protected.Text]
+		if !ok {
+			t.Fatalf("unexpected protected text %q", protected.Text)
+		}
+		restored, err := protected.Restore(translated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.TranslatedText = restored
+	}
+
+	expected := "<details>\n<summary>詳細 &lt;情報&gt; &amp; 補足</summary>\n隠れた<b>太字</b>のテキスト（<code>a &lt; b</code> &amp; x &lt; y）。\n</details>\n"
+	if got := NodesToMarkdownWithMode(nodes, RenderSource); got != expected {
+		t.Errorf("unexpected output:\n got: %q\nwant: %q", got, expected)
+	}
+}
+
+func TestRoundTripTranslatesAdmonitions(t *testing.T) {
+	source := "> [!NOTE]\n> Read this first.\n\n!!! warning \"Be careful\"\n    Do not delete it.\n\n:::tip[Pro tip]\nUse the cache.\n:::\n"
+	nodes := ParseMarkdownWithOptions(source, Options{Extensions: DefaultExtensions})
+
+	translations := map[string]string{
+		"Read this first.":  "最初に読んでください。",
+		"Be careful":        `"削除" に注意`,
+		"Do not delete it.": "削除しないでください。",
+		"Pro tip":           "[上級者向け] のヒント",
+		"Use the cache.":    "キャッシュを使います。",
+	}
+	for _, node := range nodes {
+		if node.Type == Admonition && node.AdmonitionKind == "NOTE" && node.Text != "" {
+			t.Errorf("the alert keyword should not be translated: %q", node.Text)
+		}
+		node.TranslatedText = translations[node.Text]
+	}
+
+	expected := "> [!NOTE]\n> 最初に読んでください。\n\n!!! warning \"&quot;削除&quot; に注意\"\n    削除しないでください。\n\n:::tip[\\[上級者向け\\] のヒント]\nキャッシュを使います。\n:::\n"
+	got := NodesToMarkdownWithMode(nodes, RenderSource)
+	if got != expected {
+		t.Fatalf("unexpected output:\n got: %q\nwant: %q", got, expected)
+	}
+
+	// 訳したタイトルでも開始行はアドモニションのまま
+	var titles []string
+	for _, node := range ParseMarkdownWithOptions(got, Options{Extensions: DefaultExtensions}) {
+		if node.Type == Admonition {
+			titles = append(titles, node.AdmonitionKind+":"+node.Text)
+		}
+	}
+	if got := strings.Join(titles, ", "); got != `NOTE:, warning:&quot;削除&quot; に注意, tip:\[上級者向け\] のヒント` {
+		t.Errorf("unexpected admonitions after translation: %s", got)
+	}
+}
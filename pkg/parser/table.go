@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+type Alignment int
+
+const (
+	AlignNone   Alignment = iota // | --- |
+	AlignLeft                    // | :-- |
+	AlignRight                   // | --: |
+	AlignCenter                  // | :-: |
+)
+
+var (
+	tableRowHeadPattern = regexp.MustCompile(`^[ \t>]*`)
+	codeCellPattern     = regexp.MustCompile("^(?:`[^`]+`|[A-Za-z_$][\\w$]*(?:(?:\\.|::|/|-|->)[\\w$]+)*(?:\\(\\))?)$")
+	identifierPattern   = regexp.MustCompile(`[_.:/()$]|[a-z][A-Z]`)
+)
+
+// 行の中のセルの範囲（パイプを除き、前後の空白を取り除いた範囲）
+type tableCell struct {
+	start int
+	end   int
+}
+
+// テーブルの行をエスケープされていない | で区切る
+func splitTableRow(line string) []tableCell {
+	head := len(tableRowHeadPattern.FindString(line))
+	body := strings.TrimRight(line, " \t\r")
+
+	pos := head
+	if pos < len(body) && body[pos] == '|' {
+		pos++
+	}
+
+	var cells []tableCell
+	start := pos
+	for i := pos; i <= len(body); i++ {
+		if i+1 < len(body) && body[i] == '\\' {
+			i++
+			continue
+		}
+		if i < len(body) && body[i] != '|' {
+			continue
+		}
+		if i == len(body) && start == len(body) && len(cells) > 0 {
+			// 末尾の | の後ろはセルではない
+			break
+		}
+
+		cellStart, cellEnd := start, i
+		for cellStart < cellEnd && isSpace(body[cellStart]) {
+			cellStart++
+		}
+		for cellEnd > cellStart && isSpace(body[cellEnd-1]) {
+			cellEnd--
+		}
+		cells = append(cells, tableCell{start: cellStart, end: cellEnd})
+		start = i + 1
+	}
+	return cells
+}
+
+// コードや識別子だけのセルかどうか
+func isCodeCell(text string) bool {
+	if !codeCellPattern.MatchString(text) {
+		return false
+	}
+	return strings.HasPrefix(text, "`") || identifierPattern.MatchString(text)
+}
+
+// テーブルのセルをTableCellの子にする（区切りの行は翻訳しない）
+func (b *nodeBuilder) tableCells(node *Node, n *east.Table, first, last int) {
+	for _, alignment := range n.Alignments {
+		switch alignment {
+		case east.AlignLeft:
+			node.TableAlignments = append(node.TableAlignments, AlignLeft)
+		case east.AlignRight:
+			node.TableAlignments = append(node.TableAlignments, AlignRight)
+		case east.AlignCenter:
+			node.TableAlignments = append(node.TableAlignments, AlignCenter)
+		default:
+			node.TableAlignments = append(node.TableAlignments, AlignNone)
+		}
+	}
+	columns := len(node.TableAlignments)
+
+	var cells []*Node
+	codeColumns := make([]bool, columns)
+	for i := range codeColumns {
+		codeColumns[i] = b.opts.SkipTableCodeColumns
+	}
+
+	for i := first; i <= last; i++ {
+		if i == first+1 {
+			continue
+		}
+		row := i - first
+		if row > 1 {
+			row--
+		}
+
+		line := b.lineText(i)
+		rowCells := splitTableRow(line)
+		if len(rowCells) > columns {
+			// 見出しより多いセルは表示されない
+			b.diagnose(b.lines[i].start+rowCells[columns].start, "table row has %d cells but the header has %d", len(rowCells), columns)
+		}
+		for column, cell := range rowCells {
+			if column >= columns {
+				break
+			}
+			text := line[cell.start:cell.end]
+			if row > 0 && text != "" && !isCodeCell(text) {
+				codeColumns[column] = false
+			}
+			if text == "" {
+				continue
+			}
+
+			start := b.lines[i].start + cell.start
+			end := b.lines[i].start + cell.end
+			cells = append(cells, &Node{
+				Index:       i,
+				Type:        TableCell,
+				Text:        text,
+				Start:       start,
+				End:         end,
+				TextStart:   start,
+				TextEnd:     end,
+				Raw:         text,
+				TableRow:    row,
+				TableColumn: column,
+				parent:      node,
+				fragment:    true,
+				escape:      escapeTableCell,
+			})
+		}
+	}
+
+	for _, cell := range cells {
+		// コードの列は見出しの行だけを翻訳する
+		if cell.TableRow > 0 && codeColumns[cell.TableColumn] {
+			continue
+		}
+		node.Children = append(node.Children, cell)
+	}
+}
+
+func escapeTableCell(s string) string {
+	s = strings.Join(strings.Fields(strings.ReplaceAll(s, "\n", " ")), " ")
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			escaped.WriteString(s[i : i+2])
+			i++
+			continue
+		}
+		if s[i] == '|' {
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteByte(s[i])
+	}
+	return escaped.String()
+}
+
+func hasTranslatedFragments(node *Node) bool {
+	for _, child := range node.Children {
+		if child.fragment && child.TranslatedText != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// 翻訳されたセルで元の配置のままテーブルを組み立て直す（列の幅は表示幅で揃える）
+func rebuildTable(node *Node) string {
+	columns := len(node.TableAlignments)
+	translated := map[int]string{}
+	for _, child := range node.Children {
+		if child.Type == TableCell && child.TranslatedText != "" {
+			translated[child.Start-node.Start] = child.escape(child.TranslatedText)
+		}
+	}
+
+	var rows [][]string
+	offset := 0
+	for i, line := range strings.Split(node.Raw, "\n") {
+		if i != 1 {
+			row := make([]string, columns)
+			for column, cell := range splitTableRow(line) {
+				if column >= columns {
+					break
+				}
+				row[column] = line[cell.start:cell.end]
+				if text, ok := translated[offset+cell.start]; ok {
+					row[column] = text
+				}
+			}
+			rows = append(rows, row)
+		}
+		offset += len(line) + 1
+	}
+
+	widths := make([]int, columns)
+	for i := range widths {
+		widths[i] = 3
+	}
+	for _, row := range rows {
+		for column, text := range row {
+			if width := runewidth.StringWidth(text); width > widths[column] {
+				widths[column] = width
+			}
+		}
+	}
+
+	var lines []string
+	for i, row := range rows {
+		lines = append(lines, tableRowToMarkdown(row, widths, node.TableAlignments))
+		if i == 0 {
+			lines = append(lines, tableDelimiterRow(widths, node.TableAlignments))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tableRowToMarkdown(row []string, widths []int, alignments []Alignment) string {
+	var cells []string
+	for column, text := range row {
+		padding := widths[column] - runewidth.StringWidth(text)
+		switch alignments[column] {
+		case AlignRight:
+			text = strings.Repeat(" ", padding) + text
+		case AlignCenter:
+			text = strings.Repeat(" ", padding/2) + text + strings.Repeat(" ", padding-padding/2)
+		default:
+			text += strings.Repeat(" ", padding)
+		}
+		cells = append(cells, text)
+	}
+	return "| " + strings.Join(cells, " | ") + " |"
+}
+
+func tableDelimiterRow(widths []int, alignments []Alignment) string {
+	var cells []string
+	for column, width := range widths {
+		switch alignments[column] {
+		case AlignLeft:
+			cells = append(cells, ":"+strings.Repeat("-", width-1))
+		case AlignRight:
+			cells = append(cells, strings.Repeat("-", width-1)+":")
+		case AlignCenter:
+			cells = append(cells, ":"+strings.Repeat("-", width-2)+":")
+		default:
+			cells = append(cells, strings.Repeat("-", width))
+		}
+	}
+	return "| " + strings.Join(cells, " | ") + " |"
+}
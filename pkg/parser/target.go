@@ -0,0 +1,27 @@
+package parser
+
+import "path/filepath"
+
+// 翻訳エンジンに送るNodeかどうか（notranslateの印が付いたNodeは翻訳しない）
+// HTMLTextとDiagramLabelはOptionsで有効にしたときだけ作られる
+func IsTranslationTarget(node *Node) bool {
+	if node.NoTranslate {
+		return false
+	}
+	switch node.Type {
+	case Heading, Paragraph, Item, OrderedItem, TableCell, HTMLText, Admonition, FrontMatterValue, Footnote, DiagramLabel, JSXProp, DefinitionTerm, DefinitionDescription, Abbreviation, CustomBlock:
+		return true
+	}
+	return false
+}
+
+// コマンドで共通に使うファイルの拡張子に合わせたOptions
+//   - .mdxならESMとJSXを翻訳しないようにExtMDXを有効にする
+//   - コードや識別子だけのテーブルの列は翻訳しない（translaterの -skip-code-columns の既定値と同じ）
+func OptionsForPath(path string) Options {
+	opts := Options{SkipTableCodeColumns: true}
+	if filepath.Ext(path) == ".mdx" {
+		opts.Extensions = DefaultExtensions | ExtMDX
+	}
+	return opts
+}
@@ -1,8 +1,37 @@
 package textprocesser
 
-import "regexp"
+import (
+	"regexp"
+	"unicode"
+)
 
 func ContainsEnglishWords(text string) bool {
 	englishWordPattern := regexp.MustCompile(`\b[a-zA-Z]+\b`)
 	return englishWordPattern.MatchString(text)
-}
\ No newline at end of file
+}
+
+// 言語ごとに、その言語で書かれていると判断する文字
+var languageScripts = map[string][]*unicode.RangeTable{
+	"ja": {unicode.Hiragana, unicode.Katakana, unicode.Han},
+	"zh": {unicode.Han},
+	"ko": {unicode.Hangul},
+	"ru": {unicode.Cyrillic},
+}
+
+// textにlangの言語で書かれた部分（翻訳が必要な部分）があるかどうか
+// 知らない言語はラテン文字の単語があるかで判断する
+func ContainsLanguage(text, lang string) bool {
+	if lang == "en" {
+		return ContainsEnglishWords(text)
+	}
+	scripts, ok := languageScripts[lang]
+	if !ok {
+		scripts = []*unicode.RangeTable{unicode.Latin}
+	}
+	for _, r := range text {
+		if unicode.IsOneOf(scripts, r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package translate
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// <<<SEG index>>> の行で区切ってまとめたテキストを訳すときの指示（ChatTranslator.Systemに入れる）
+const BatchSystemPrompt = "The text consists of numbered segments that each start with a marker line like <<<SEG 0>>>. Translate each segment separately. Keep every marker line exactly as it is, on its own line, in the same order, and never merge, split or drop segments."
+
+// 区切りの行（[1] のような行頭の番号は脚注やリンクのラベルとして訳に出てくるのでMarkdownに出てこない形にする）
+var segmentMarkerPattern = regexp.MustCompile(`(?m)^<<<SEG (\d+)>>>[ \t]*$`)
+
+// 複数のテキストを <<<SEG index>>> の行で区切って1回のリクエストで翻訳するTranslator
+// 返答から番号ごとに訳を取り出し、抜けたり結合されたりしたテキストだけを1つずつ翻訳し直す
+type BatchTranslator struct {
+	Translator  Translator // まとめたテキストを翻訳するTranslator
+	MaxTokens   int        // 1回のリクエストにまとめるテキストのトークン数の上限（目安）
+	Concurrency int        // 同時に送るリクエストの数
+	// まとめたリクエストが終わるたびに呼ばれる
+	Progress func(done, total int)
+	// index番目のテキストの文書の文脈（まとめたリクエストには先頭のテキストの文脈を付ける）
+	DocumentContext func(index int) *DocumentContext
+}
+
+func NewBatchTranslator(translator Translator, maxTokens int) *BatchTranslator {
+	return &BatchTranslator{
+		Translator:  translator,
+		MaxTokens:   maxTokens,
+		Concurrency: 4,
+	}
+}
+
+// テキストのトークン数の目安（ASCIIは4文字で1トークン、それ以外は1文字で1トークンと数える）
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// エラーを返すときも、訳せたテキストはResult.Textsに入れる（訳せなかったテキストは空文字列）
+func (t *BatchTranslator) Translate(ctx context.Context, texts []string) (*Result, error) {
+	result := &Result{Texts: make([]string, len(texts))}
+	batches := t.batches(texts)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	done := 0
+	concurrency := t.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	for _, batch := range batches {
+		batch := batch
+		wg.Add(1)
+		go func() {
+			semaphore <- struct{}{}
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			translated, usage, err := t.translateBatch(ctx, texts, batch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Usage.Add(usage)
+			// 失敗したまとまりでも訳せたテキストは返す
+			for i, text := range translated {
+				result.Texts[i] = text
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			done++
+			if t.Progress != nil {
+				t.Progress(done, len(batches))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return result, firstErr
+	}
+	return result, nil
+}
+
+// textsをMaxTokensを超えないように先頭から順にまとめる（1つで超えるテキストはそれだけで送る）
+func (t *BatchTranslator) batches(texts []string) [][]int {
+	var batches [][]int
+	var batch []int
+	tokens := 0
+	for i, text := range texts {
+		n := EstimateTokens(text)
+		if len(batch) > 0 && tokens+n > t.MaxTokens {
+			batches = append(batches, batch)
+			batch = nil
+			tokens = 0
+		}
+		batch = append(batch, i)
+		tokens += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func (t *BatchTranslator) translateBatch(ctx context.Context, texts []string, batch []int) (map[int]string, Usage, error) {
+	var usage Usage
+	var packed strings.Builder
+	for _, i := range batch {
+		packed.WriteString(formatSegment(i, texts[i]))
+	}
+
+	res, err := t.Translator.Translate(t.withDocumentContext(ctx, batch[0]), []string{packed.String()})
+	if res != nil {
+		usage.Add(res.Usage)
+	}
+	if err != nil {
+		return nil, usage, err
+	}
+
+	translated, retries := parseSegments(res.Texts[0], batch)
+
+	// 抜けたり結合されたりしたテキストは1つずつ翻訳し直す
+	for _, i := range retries {
+		res, err := t.Translator.Translate(t.withDocumentContext(ctx, i), []string{formatSegment(i, texts[i])})
+		if res != nil {
+			usage.Add(res.Usage)
+		}
+		if err != nil {
+			// 翻訳し直せなかったテキストだけを除いて返す
+			return translated, usage, err
+		}
+		reply := res.Texts[0]
+		if segments, missing := parseSegments(reply, []int{i}); len(missing) == 0 {
+			translated[i] = segments[i]
+		} else {
+			// 番号を付けずに返ってきたときは返答全体を訳とする
+			translated[i] = strings.TrimSpace(reply)
+		}
+	}
+	return translated, usage, nil
+}
+
+func (t *BatchTranslator) withDocumentContext(ctx context.Context, index int) context.Context {
+	if t.DocumentContext == nil {
+		return ctx
+	}
+	if document := t.DocumentContext(index); document != nil {
+		return WithDocumentContext(ctx, document)
+	}
+	return ctx
+}
+
+func formatSegment(index int, text string) string {
+	return "<<<SEG " + strconv.Itoa(index) + ">>>\n" + text + "\n"
+}
+
+// 返答を <<<SEG index>>> ごとに分け、訳と翻訳し直すindexを返す
+//   - 返答に無い番号と訳が空の番号
+//   - 2回以上出てきた番号
+//   - 番号が抜けた直前の番号（抜けたテキストが結合されている）
+func parseSegments(reply string, indexes []int) (map[int]string, []int) {
+	expected := map[int]bool{}
+	for _, i := range indexes {
+		expected[i] = true
+	}
+
+	type segment struct {
+		index      int
+		start, end int
+	}
+	var segments []segment
+	retry := map[int]bool{}
+	last := -1
+	for _, loc := range segmentMarkerPattern.FindAllStringSubmatchIndex(reply, -1) {
+		index, err := strconv.Atoi(reply[loc[2]:loc[3]])
+		if err != nil || !expected[index] {
+			continue
+		}
+		if index <= last {
+			// 重複した番号や順番が入れ替わった番号の前後は信用しない
+			retry[index] = true
+			if len(segments) > 0 {
+				retry[segments[len(segments)-1].index] = true
+			}
+			continue
+		}
+		if len(segments) > 0 {
+			segments[len(segments)-1].end = loc[0]
+		}
+		segments = append(segments, segment{index: index, start: loc[1], end: len(reply)})
+		last = index
+	}
+
+	translated := map[int]string{}
+	for _, s := range segments {
+		if text := strings.TrimSpace(reply[s.start:s.end]); text != "" {
+			translated[s.index] = text
+		}
+	}
+
+	previous := -1
+	for _, i := range indexes {
+		if _, ok := translated[i]; !ok {
+			retry[i] = true
+			if previous >= 0 {
+				retry[previous] = true
+			}
+			continue
+		}
+		previous = i
+	}
+
+	retries := []int{}
+	for i := range retry {
+		delete(translated, i)
+		retries = append(retries, i)
+	}
+	sort.Ints(retries)
+	return translated, retries
+}
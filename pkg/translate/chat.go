@@ -0,0 +1,82 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/gpt35"
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/gpt35/generator"
+)
+
+// Chat Completions APIで翻訳するTranslator（テキストごとにプロンプトを作って1回ずつ呼び出す）
+type ChatTranslator struct {
+	client *gpt35.Client
+	Model  gpt35.ModelType
+	// プロンプトの前に送るsystemのメッセージ（空なら送らない）
+	System string
+	// モデルのトークン数の上限（WithDocumentContextで付けた文脈はこれに収まるように削る）
+	MaxTokens int
+	// 翻訳するテキストからプロンプトを作る（templates/translate.<source>-<target>.txt か templates/translate.txt）
+	Prompt func(text string) (string, error)
+}
+
+func NewChatTranslator(client *gpt35.Client, languages LanguagePair) *ChatTranslator {
+	return &ChatTranslator{
+		client:    client,
+		Model:     gpt35.ModelGpt35Turbo,
+		MaxTokens: gpt35.MaxTokensGpt35Turbo,
+		Prompt: func(text string) (string, error) {
+			return generator.GenerateGptInputStringFor(text, languages.Source, languages.Target)
+		},
+	}
+}
+
+func (t *ChatTranslator) Translate(ctx context.Context, texts []string) (*Result, error) {
+	result := &Result{}
+	for _, text := range texts {
+		prompt, err := t.Prompt(text)
+		if err != nil {
+			return result, err
+		}
+
+		req := &gpt35.Request{
+			Model: t.Model,
+			Messages: []*gpt35.Message{
+				{
+					Role:    gpt35.RoleUser,
+					Content: prompt,
+				},
+			},
+		}
+		// 文書の文脈は訳の分のトークンを残して入れる
+		if document := DocumentContextFrom(ctx); document != nil {
+			if message := document.Format(t.MaxTokens - EstimateTokens(t.System) - EstimateTokens(prompt)*2); message != "" {
+				req.Messages = append([]*gpt35.Message{{Role: gpt35.RoleSystem, Content: message}}, req.Messages...)
+			}
+		}
+		if t.System != "" {
+			req.Messages = append([]*gpt35.Message{{Role: gpt35.RoleSystem, Content: t.System}}, req.Messages...)
+		}
+
+		resp, err := t.client.GetChatContext(ctx, req)
+		result.Usage.Requests++
+		if err != nil {
+			return result, err
+		}
+		if resp.Usage != nil {
+			result.Usage.PromptTokens += resp.Usage.PromptTokens
+			result.Usage.CompletionTokens += resp.Usage.CompletionTokens
+			result.Usage.TotalTokens += resp.Usage.TotalTokens
+		}
+		if resp.Error != nil {
+			return result, fmt.Errorf("%s: %s", resp.Error.Type, resp.Error.Message)
+		}
+		if len(resp.Choices) == 0 {
+			return result, errors.New("no choices in the response")
+		}
+
+		result.Texts = append(result.Texts, resp.Choices[0].Message.Content)
+	}
+	return result, nil
+}
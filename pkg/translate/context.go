@@ -0,0 +1,71 @@
+package translate
+
+import (
+	"context"
+	"strings"
+)
+
+// 翻訳するテキストの周りの文書の情報（プロンプトに読み取り専用の文脈として入れる）
+type DocumentContext struct {
+	Title    string    // 文書のタイトル
+	Headings []string  // テキストを含む見出しの階層（上の階層から順）
+	Previous []Passage // 直前の段落（文書の先頭に近い順）
+}
+
+// 直前の段落の原文と訳（まだ訳していなければTranslatedは空）
+type Passage struct {
+	Source     string
+	Translated string
+}
+
+type documentContextKey struct{}
+
+// ctxに文書の情報を付ける（ChatTranslatorはプロンプトの前に文脈として送る）
+func WithDocumentContext(ctx context.Context, document *DocumentContext) context.Context {
+	return context.WithValue(ctx, documentContextKey{}, document)
+}
+
+func DocumentContextFrom(ctx context.Context) *DocumentContext {
+	document, _ := ctx.Value(documentContextKey{}).(*DocumentContext)
+	return document
+}
+
+// maxTokensに収まるように古い段落から削って文脈のメッセージを作る（収まらなければ空文字列）
+func (d *DocumentContext) Format(maxTokens int) string {
+	previous := d.Previous
+	for {
+		message := d.format(previous)
+		if EstimateTokens(message) <= maxTokens {
+			return message
+		}
+		if len(previous) == 0 {
+			return ""
+		}
+		previous = previous[1:]
+	}
+}
+
+func (d *DocumentContext) format(previous []Passage) string {
+	if d.Title == "" && len(d.Headings) == 0 && len(previous) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("The following is context from the same document. It is for reference only: use it to keep terminology, pronouns and tone consistent, but do not translate it or include it in your answer.\n")
+	if d.Title != "" {
+		b.WriteString("\nDocument title: " + d.Title + "\n")
+	}
+	if len(d.Headings) > 0 {
+		b.WriteString("\nSection: " + strings.Join(d.Headings, " > ") + "\n")
+	}
+	if len(previous) > 0 {
+		b.WriteString("\nPrevious paragraphs:\n")
+		for _, passage := range previous {
+			b.WriteString("\nSource: " + passage.Source + "\n")
+			if passage.Translated != "" {
+				b.WriteString("Translation: " + passage.Translated + "\n")
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package translate
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(?:-[A-Za-z]{2,4})?$`)
+
+// 翻訳元と翻訳先の言語（en, ja, ko のようなコード）
+type LanguagePair struct {
+	Source string
+	Target string
+}
+
+var DefaultLanguagePair = LanguagePair{Source: "en", Target: "ja"}
+
+func (p LanguagePair) String() string {
+	return p.Source + "-" + p.Target
+}
+
+func (p LanguagePair) Validate() error {
+	for _, code := range []string{p.Source, p.Target} {
+		if !languageCodePattern.MatchString(code) {
+			return fmt.Errorf("invalid language code: %q", code)
+		}
+	}
+	if p.Source == p.Target {
+		return fmt.Errorf("source and target languages are the same: %s", p.Source)
+	}
+	return nil
+}
@@ -1,9 +1,9 @@
 package translate
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -14,29 +14,77 @@ type ResGoogleTranslate struct {
 	Text string `json:"text"`
 }
 
-func Translate(text string) (string, error) {
-	var res ResGoogleTranslate
+// Google Apps ScriptのLanguageAppで翻訳するURL（text・source・targetのクエリを付けて呼び出す）
+var DefaultAppsScriptURLs = []string{"https://script.google.com/macros/s/AKfycbwU3rp-wP0wC0rHy1uajb61bKCQGDB4TJ8HofbtU_KCB3hmjKol0-_I8ABXr9Pr_aIAOg/exec", "https://script.google.com/macros/s/AKfycbxXtSoPH_UDtGD-bZpWt6Gx2m3s0GyKTjO1LHCteVvMJNje5PDytKmzzTR7vRMb0Nmm/exec", "https://script.google.com/macros/s/AKfycbyQAvp99EoatfQYZ3pBQDpLr4TWazEUzyNFAiNUT3osWD388S27hHaPx0sjuNe7nZON0A/exec", "https://script.google.com/macros/s/AKfycbwPd2RT9cOHksOSodK9R-ERoqGWgwBntLFOKhZtMEk5AcAlI6J0uCOlJ2gCcxQ9MhpKrA/exec"}
+
+// Google Apps Scriptで翻訳するTranslator（URLを順に試し、それぞれRetries回まで再試行する）
+type AppsScriptTranslator struct {
+	URLs      []string
+	Retries   int
+	Languages LanguagePair
+	client    *http.Client
+}
 
-	urls := [4]string{"https://script.google.com/macros/s/AKfycbwU3rp-wP0wC0rHy1uajb61bKCQGDB4TJ8HofbtU_KCB3hmjKol0-_I8ABXr9Pr_aIAOg/exec?text=%v&source=en&target=ja", "https://script.google.com/macros/s/AKfycbxXtSoPH_UDtGD-bZpWt6Gx2m3s0GyKTjO1LHCteVvMJNje5PDytKmzzTR7vRMb0Nmm/exec?text=%v&source=en&target=ja", "https://script.google.com/macros/s/AKfycbyQAvp99EoatfQYZ3pBQDpLr4TWazEUzyNFAiNUT3osWD388S27hHaPx0sjuNe7nZON0A/exec?text=%v&source=en&target=ja", "https://script.google.com/macros/s/AKfycbwPd2RT9cOHksOSodK9R-ERoqGWgwBntLFOKhZtMEk5AcAlI6J0uCOlJ2gCcxQ9MhpKrA/exec?text=%v&source=en&target=ja"}
-	for _, urlFormatStr := range urls {
-		url := fmt.Sprintf(urlFormatStr, url.QueryEscape(text))
+func NewAppsScriptTranslator(languages LanguagePair) *AppsScriptTranslator {
+	return &AppsScriptTranslator{
+		URLs:      DefaultAppsScriptURLs,
+		Retries:   10,
+		Languages: languages,
+		client:    http.DefaultClient,
+	}
+}
+
+func (t *AppsScriptTranslator) Translate(ctx context.Context, texts []string) (*Result, error) {
+	result := &Result{}
+	for _, text := range texts {
+		translated, requests, err := t.translate(ctx, text)
+		result.Usage.Requests += requests
+		if err != nil {
+			return result, err
+		}
+		result.Texts = append(result.Texts, translated)
+	}
+	return result, nil
+}
 
-		for i := 0; i < 10; i++ {
-			resp, err := http.Get(url)
+func (t *AppsScriptTranslator) translate(ctx context.Context, text string) (string, int, error) {
+	requests := 0
+	query := url.Values{"text": {text}, "source": {t.Languages.Source}, "target": {t.Languages.Target}}
+	for _, baseURL := range t.URLs {
+		url := baseURL + "?" + query.Encode()
+
+		for i := 0; i < t.Retries; i++ {
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 			if err != nil {
-				panic(err)
+				return "", requests, err
+			}
+			requests++
+			resp, err := t.client.Do(req)
+			if err != nil {
+				if ctx.Err() != nil {
+					return "", requests, ctx.Err()
+				}
+				continue
 			}
-
-			defer resp.Body.Close()
 
 			byteArray, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
 
+			var res ResGoogleTranslate
 			json.Unmarshal(byteArray, &res)
 
 			if res.Code == 200 {
-				return res.Text, nil
+				return res.Text, requests, nil
 			}
 		}
 	}
-	return "", errors.New("翻訳に失敗")
+	return "", requests, errors.New("翻訳に失敗")
+}
+
+func Translate(text string) (string, error) {
+	result, err := NewAppsScriptTranslator(DefaultLanguagePair).Translate(context.Background(), []string{text})
+	if err != nil {
+		return "", err
+	}
+	return result.Texts[0], nil
 }
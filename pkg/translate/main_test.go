@@ -0,0 +1,180 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sofuetakuma112/go-markdown-translater/pkg/gpt35"
+)
+
+func TestTranslators(t *testing.T) {
+	appsScript := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		json.NewEncoder(w).Encode(ResGoogleTranslate{Code: 200, Text: query.Get("target") + ":" + query.Get("text")})
+	}))
+	defer appsScript.Close()
+
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req gpt35.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(gpt35.Response{
+			Choices: []*gpt35.Choice{{Message: &gpt35.Message{Content: "訳:" + req.Messages[0].Content}}},
+			Usage:   &gpt35.Usage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+		})
+	}))
+	defer chat.Close()
+
+	apps := NewAppsScriptTranslator(LanguagePair{Source: "en", Target: "ko"})
+	apps.URLs = []string{appsScript.URL}
+	gpt := NewChatTranslator(gpt35.NewClientCustomUrl("key", chat.URL), DefaultLanguagePair)
+	gpt.Prompt = func(text string) (string, error) { return text, nil }
+
+	for name, tc := range map[string]struct {
+		translator Translator
+		prefix     string
+		usage      Usage
+	}{
+		"apps-script": {apps, "ko:", Usage{Requests: 2}},
+		"chat":        {gpt, "訳:", Usage{Requests: 2, PromptTokens: 6, CompletionTokens: 4, TotalTokens: 10}},
+	} {
+		result, err := tc.translator.Translate(context.Background(), []string{"a b", "c"})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if fmt.Sprint(result.Texts) != fmt.Sprintf("[%sa b %sc]", tc.prefix, tc.prefix) || result.Usage != tc.usage {
+			t.Errorf("%s: unexpected result %v %+v", name, result.Texts, result.Usage)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := gpt.Translate(ctx, []string{"a"}); err == nil {
+		t.Error("canceled context should stop the request")
+	}
+}
+
+// 区切りの行以外に「訳:」を付けて返し、mergeの区切りの行だけは消して直前のテキストに結合して返すTranslator
+// failの区切りの行で始まる1つだけのテキストを翻訳し直すリクエストは失敗する
+type fakeBatchTranslator struct {
+	merge    string
+	fail     string
+	requests []string
+}
+
+func (t *fakeBatchTranslator) Translate(ctx context.Context, texts []string) (*Result, error) {
+	result := &Result{Usage: Usage{Requests: 1}}
+	for _, text := range texts {
+		t.requests = append(t.requests, text)
+		single := len(segmentMarkerPattern.FindAllString(text, -1)) == 1
+		if t.fail != "" && single && strings.HasPrefix(text, t.fail+"\n") {
+			return result, errors.New("request failed")
+		}
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+			switch {
+			case line == t.merge && !single:
+			case segmentMarkerPattern.MatchString(line):
+				lines = append(lines, line)
+			default:
+				lines = append(lines, "訳:"+line)
+			}
+		}
+		result.Texts = append(result.Texts, strings.Join(lines, "\n")+"\n")
+	}
+	return result, nil
+}
+
+func TestBatchTranslator(t *testing.T) {
+	fake := &fakeBatchTranslator{merge: "<<<SEG 2>>>"}
+	batch := NewBatchTranslator(fake, 4)
+	batch.Concurrency = 1
+
+	result, err := batch.Translate(context.Background(), []string{"one", "two", "three", "a long text over the budget", "five"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"訳:one", "訳:two", "訳:three", "訳:a long text over the budget", "訳:five"}
+	if fmt.Sprint(result.Texts) != fmt.Sprint(want) {
+		t.Errorf("unexpected texts %q", result.Texts)
+	}
+	// 0〜2・3・4 の3回と、結合された1・2を1つずつ翻訳し直した2回
+	if result.Usage.Requests != 5 {
+		t.Errorf("unexpected requests %d: %q", result.Usage.Requests, fake.requests)
+	}
+
+	translated, retries := parseSegments("<<<SEG 0>>>\na\n<<<SEG 1>>>\nb\n<<<SEG 1>>>\nc\n<<<SEG 3>>>\nd\n", []int{0, 1, 2, 3})
+	if fmt.Sprint(translated) != "map[0:a 3:d]" || fmt.Sprint(retries) != "[1 2]" {
+		t.Errorf("unexpected segments %v %v", translated, retries)
+	}
+
+	// 行頭の [1] のような脚注やリンクのラベルを区切りと間違えない
+	fake = &fakeBatchTranslator{}
+	batch = NewBatchTranslator(fake, 100)
+	result, err = batch.Translate(context.Background(), []string{"[1] Smith, 2020\n[2] Doe, 2021", "[0]: https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"訳:[1] Smith, 2020\n訳:[2] Doe, 2021", "訳:[0]: https://example.com"}
+	if fmt.Sprintf("%q", result.Texts) != fmt.Sprintf("%q", want) || result.Usage.Requests != 1 {
+		t.Errorf("unexpected texts with bracketed labels %q (%d requests)", result.Texts, result.Usage.Requests)
+	}
+
+	// 翻訳し直しに失敗しても、訳せたテキストと他のまとまりの訳は返す
+	fake = &fakeBatchTranslator{merge: "<<<SEG 2>>>", fail: "<<<SEG 2>>>"}
+	batch = NewBatchTranslator(fake, 4)
+	result, err = batch.Translate(context.Background(), []string{"one", "two", "three", "a long text over the budget"})
+	if err == nil {
+		t.Fatal("failed retry should be reported")
+	}
+	want = []string{"訳:one", "訳:two", "", "訳:a long text over the budget"}
+	if fmt.Sprintf("%q", result.Texts) != fmt.Sprintf("%q", want) {
+		t.Errorf("unexpected texts after failure %q", result.Texts)
+	}
+}
+
+func TestDocumentContext(t *testing.T) {
+	var messages []*gpt35.Message
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req gpt35.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		messages = req.Messages
+		json.NewEncoder(w).Encode(gpt35.Response{Choices: []*gpt35.Choice{{Message: &gpt35.Message{Content: "訳"}}}})
+	}))
+	defer chat.Close()
+
+	gpt := NewChatTranslator(gpt35.NewClientCustomUrl("key", chat.URL), DefaultLanguagePair)
+	gpt.Prompt = func(text string) (string, error) { return text, nil }
+
+	document := &DocumentContext{
+		Title:    "Guide",
+		Headings: []string{"Install", "Linux"},
+		Previous: []Passage{{Source: "First paragraph.", Translated: "最初の段落。"}, {Source: "Run the following commands:"}},
+	}
+	if _, err := gpt.Translate(WithDocumentContext(context.Background(), document), []string{"- Install the package"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Role != gpt35.RoleSystem || messages[1].Content != "- Install the package" {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+	for _, want := range []string{"Document title: Guide", "Section: Install > Linux", "Translation: 最初の段落。", "Source: Run the following commands:"} {
+		if !strings.Contains(messages[0].Content, want) {
+			t.Errorf("context does not contain %q:\n%s", want, messages[0].Content)
+		}
+	}
+
+	// トークン数の上限に収まらない段落は古いものから削る
+	full := document.Format(1000)
+	trimmed := document.Format(EstimateTokens(full) - 1)
+	if strings.Contains(trimmed, "First paragraph.") || !strings.Contains(trimmed, "Run the following commands:") {
+		t.Errorf("the oldest paragraph should be dropped:\n%s", trimmed)
+	}
+	if document.Format(10) != "" {
+		t.Error("context that does not fit should be empty")
+	}
+}
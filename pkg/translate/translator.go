@@ -0,0 +1,29 @@
+package translate
+
+import "context"
+
+// 翻訳エンジン（Apps Script・Chat Completionsなど）の共通のインターフェース
+type Translator interface {
+	// textsをまとめて翻訳し、同じ順に並べた翻訳を返す
+	Translate(ctx context.Context, texts []string) (*Result, error)
+}
+
+type Result struct {
+	Texts []string // textsと同じ順の翻訳
+	Usage Usage
+}
+
+// 翻訳にかかったAPIの呼び出し回数とトークン数
+type Usage struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+func (u *Usage) Add(other Usage) {
+	u.Requests += other.Requests
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}